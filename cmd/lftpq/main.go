@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -8,31 +10,58 @@ import (
 	"os/signal"
 	"path/filepath"
 	"sort"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/mpolden/lftpq/lftp"
+	"github.com/mpolden/lftpq/parser"
 	"github.com/mpolden/lftpq/queue"
 )
 
 type lister interface {
 	List(site, path string) ([]os.FileInfo, error)
+	DirSizes(site, path string) (map[string]int64, error)
+	Cat(site, path string) ([]byte, error)
 }
 
+// siteLister lists and reads files on a single site
+type siteLister struct {
+	lister lister
+	site   string
+}
+
+func (l siteLister) List(path string) ([]os.FileInfo, error) { return l.lister.List(l.site, path) }
+func (l siteLister) Cat(path string) ([]byte, error)         { return l.lister.Cat(l.site, path) }
+
+type sizedFile struct {
+	os.FileInfo
+	size int64
+}
+
+func (f sizedFile) Size() int64 { return f.size }
+
 type CLI struct {
-	Config   string
-	Dryrun   bool
-	Format   string
-	Test     bool
-	Quiet    bool
-	Import   bool
-	LocalDir string
-	LftpPath string
-	Name     string
-	consumer queue.Consumer
-	lister   lister
-	stderr   io.Writer
-	stdout   io.Writer
-	stdin    io.Reader
+	Config       string
+	Dryrun       bool
+	Format       string
+	Test         bool
+	Quiet        bool
+	Import       bool
+	LocalDir     string
+	LftpPath     string
+	Name         string
+	ClassifyDirs string
+	Organize     string
+	Undo         string
+	Progress     bool
+	Resume       bool
+	stateFile    string
+	consumer     queue.Consumer
+	lister       lister
+	stderr       io.Writer
+	stdout       io.Writer
+	stdin        io.Reader
 }
 
 func New() *CLI {
@@ -52,6 +81,7 @@ func (c *CLI) Run() error {
 	if err != nil {
 		return err
 	}
+	defer cfg.Close()
 	if c.LocalDir != "" {
 		if err := cfg.SetLocalDir(c.LocalDir); err != nil {
 			return err
@@ -68,7 +98,16 @@ func (c *CLI) Run() error {
 	if c.Name != "" {
 		return c.classify(cfg.LocalDirs)
 	}
-	var queues []queue.Queue
+	if c.Organize != "" {
+		return c.organize(cfg.LocalDirs)
+	}
+	if c.Undo != "" {
+		return c.undo()
+	}
+	var (
+		queues []queue.Queue
+		state  *queue.State
+	)
 	if c.Import {
 		if queues, err = queue.Read(cfg.Sites, c.stdin); err != nil {
 			return err
@@ -78,42 +117,150 @@ func (c *CLI) Run() error {
 			return fmt.Errorf("already running: %s", err)
 		}
 		defer c.unlock()
-		queues = c.queuesFor(cfg.Sites)
+		if c.Resume {
+			if state, err = queue.ReadState(c.statefile()); err != nil {
+				return fmt.Errorf("nothing to resume: %s", err)
+			}
+			if queues, err = state.Resume(cfg.Sites); err != nil {
+				return err
+			}
+		} else {
+			queues = c.queuesFor(cfg.Sites)
+		}
 	}
+	if !c.Dryrun {
+		if state == nil {
+			state = queue.NewState(c.statefile(), queues)
+			// Unfinished items of an earlier run can still be resumed
+			if old, err := queue.ReadState(c.statefile()); err == nil {
+				state.Merge(old)
+			}
+		}
+		if err := state.Save(); err != nil {
+			return err
+		}
+	}
+	failed := false
 	for _, q := range queues {
-		if err := c.transfer(q); err != nil {
+		if err := c.transfer(q, state); err != nil {
 			c.printf("error while transferring queue for %s: %s\n", q.Site.Name, err)
+			failed = true
 			continue
 		}
 	}
+	// Keep state until every queue has completed
+	if state != nil && !c.Dryrun && !failed && state.Completed() {
+		return state.Remove()
+	}
 	return nil
 }
 
-func (c *CLI) classify(dirs []queue.LocalDir) error {
-	name := filepath.Base(c.Name)
+type classification struct {
+	Name     string
+	LocalDir string
+	Parser   string
+	Media    parser.Media
+	Path     string
+	Error    string
+}
+
+func (c *CLI) classifyDirs(dirs []queue.LocalDir) ([]queue.LocalDir, error) {
+	if c.ClassifyDirs != "" {
+		var selected []queue.LocalDir
+		for _, name := range strings.Split(c.ClassifyDirs, ",") {
+			found := false
+			for _, dir := range dirs {
+				if dir.Name == name {
+					selected = append(selected, dir)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("invalid local dir: %q", name)
+			}
+		}
+		return selected, nil
+	}
 	sortedDirs := make([]queue.LocalDir, len(dirs))
 	copy(sortedDirs, dirs)
-	// Sort parsers in this order: show, movie, default
-	sort.Slice(sortedDirs, func(i, j int) bool {
-		return (sortedDirs[i].Parser == "show" && sortedDirs[j].Parser != "show") ||
-			(sortedDirs[i].Parser != "" && sortedDirs[j].Parser == "")
+	// Local dirs with the same precedence are tried in the order they are configured
+	sort.SliceStable(sortedDirs, func(i, j int) bool {
+		return parserPrecedence(sortedDirs[i].Parser) < parserPrecedence(sortedDirs[j].Parser)
 	})
-	parsed := false
-	for _, dir := range sortedDirs {
+	return sortedDirs, nil
+}
+
+// parserPrecedence returns the position of parser in the order used when classifying: show, movie, music,
+// audiobook, custom parsers and lastly the default parser.
+func parserPrecedence(parser string) int {
+	for i, p := range []string{"show", "movie", "music", "audiobook"} {
+		if parser == p {
+			return i
+		}
+	}
+	if parser == "" {
+		return 5
+	}
+	return 4
+}
+
+func classifyName(dirs []queue.LocalDir, name string) (classification, error) {
+	name = filepath.Base(name)
+	for _, dir := range dirs {
 		media, err := dir.Media(name)
 		if err != nil {
 			continue // Try next parser
 		}
-		path, err := media.PathIn(dir.Template)
+		path, err := dir.Path(media)
 		if err != nil {
-			return err
+			return classification{}, err
 		}
-		parsed = true
-		fmt.Fprintln(c.stdout, path)
-		break
+		return classification{Name: name, LocalDir: dir.Name, Parser: dir.Parser, Media: media, Path: path}, nil
 	}
-	if !parsed {
-		return fmt.Errorf("parsing failed: %q", name)
+	return classification{}, fmt.Errorf("parsing failed: %q", name)
+}
+
+func (c *CLI) classify(dirs []queue.LocalDir) error {
+	dirs, err := c.classifyDirs(dirs)
+	if err != nil {
+		return err
+	}
+	if c.Name == "-" {
+		return c.classifyAll(dirs)
+	}
+	result, err := classifyName(dirs, c.Name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.stdout, result.Path)
+	return nil
+}
+
+func (c *CLI) classifyAll(dirs []queue.LocalDir) error {
+	var names []string
+	scanner := bufio.NewScanner(c.stdin)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			names = append(names, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for i := range dirs {
+		// Errors are reported for each name when parsing
+		dirs[i].Prefetch(names)
+	}
+	enc := json.NewEncoder(c.stdout)
+	for _, name := range names {
+		result, err := classifyName(dirs, name)
+		if err != nil {
+			result = classification{Name: filepath.Base(name), Error: err.Error()}
+		}
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -127,6 +274,13 @@ func (c *CLI) lock() error {
 
 func (c *CLI) unlock() { os.Remove(c.lockfile()) }
 
+func (c *CLI) statefile() string {
+	if c.stateFile != "" {
+		return c.stateFile
+	}
+	return filepath.Join(os.TempDir(), ".lftpqstate")
+}
+
 func (c *CLI) printf(format string, vs ...interface{}) {
 	alwaysPrint := false
 	for _, v := range vs {
@@ -148,22 +302,43 @@ func (c *CLI) queuesFor(sites []queue.Site) []queue.Queue {
 			c.printf("skipping site %s\n", s.Name)
 			continue
 		}
+		dirs, err := s.RemoteDirs(time.Now())
+		if err != nil {
+			c.printf("error while expanding dirs on %s: %s\n", s.Name, err)
+			continue
+		}
 		var files []os.FileInfo
-		for _, dir := range s.Dirs {
-			f, err := c.lister.List(s.Name, dir)
+		for _, dir := range dirs {
+			f, err := s.List(dir, func(path string) ([]os.FileInfo, error) { return c.list(s, path) })
 			if err != nil {
 				c.printf("error while listing %s on %s: %s\n", dir, s.Name, err)
-				continue
 			}
 			files = append(files, f...)
 		}
-		queue := queue.New(s, files)
+		queue := queue.New(s, files, siteLister{lister: c.lister, site: s.Name})
 		queues = append(queues, queue)
 	}
 	return queues
 }
 
-func (c *CLI) transfer(q queue.Queue) error {
+func (c *CLI) list(site queue.Site, path string) ([]os.FileInfo, error) {
+	files, err := c.lister.List(site.Name, path)
+	if err != nil || !site.DirSizes {
+		return files, err
+	}
+	sizes, err := c.lister.DirSizes(site.Name, path)
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range files {
+		if size, ok := sizes[f.Name()]; ok && f.IsDir() {
+			files[i] = sizedFile{FileInfo: f, size: size}
+		}
+	}
+	return files, nil
+}
+
+func (c *CLI) transfer(q queue.Queue, state *queue.State) error {
 	if c.Dryrun {
 		var (
 			out []byte
@@ -175,18 +350,51 @@ func (c *CLI) transfer(q queue.Queue) error {
 		} else {
 			out, err = q.MarshalText()
 		}
-		if err == nil {
-			fmt.Fprint(c.stdout, string(out))
+		if err != nil {
+			return err
 		}
-		return err
+		fmt.Fprint(c.stdout, string(out))
+		if c.Format != "json" {
+			c.printf("%s: %d items, %s\n", q.Site.Name, len(q.Transferable()), queue.FormatSize(q.TransferSize()))
+		}
+		return nil
 	}
 	if len(q.Transferable()) == 0 {
 		c.printf("%s queue is empty\n", q.Site.Name)
 		return nil
 	}
+	if !q.InTransferWindow() {
+		// Planned items stay unfinished in the state, so that they can be resumed
+		c.printf("%s queue deferred: outside transfer windows\n", q.Site.Name)
+		return nil
+	}
 	if err := q.Transfer(c.consumer); err != nil {
 		return err
 	}
+	verifyErr := q.Verify(c.consumer)
+	// Items that failed verification remain unfinished
+	var done []*queue.Item
+	for _, item := range q.Transferable() {
+		if item.VerifyError == "" {
+			done = append(done, item)
+		}
+	}
+	state.Done(q.Site.Name, done)
+	if err := state.Save(); err != nil {
+		return err
+	}
+	if verifyErr != nil {
+		return verifyErr
+	}
+	for _, item := range q.Unverified() {
+		c.printf("%s: verification failed: %s: %s\n", q.Site.Name, item.RemotePath, item.VerifyError)
+	}
+	q.Extract()
+	for _, item := range q.Transferable() {
+		if item.ExtractError != "" {
+			c.printf("%s: extraction failed: %s: %s\n", q.Site.Name, item.RemotePath, item.ExtractError)
+		}
+	}
 	return q.PostProcess(!c.Quiet)
 }
 
@@ -203,9 +411,18 @@ func main() {
 	flag.BoolVar(&cli.Import, "i", false, "Build queues from stdin")
 	flag.StringVar(&cli.LocalDir, "l", "", "Override local dir for this run")
 	flag.StringVar(&cli.LftpPath, "p", "lftp", "Path to lftp program")
-	flag.StringVar(&cli.Name, "c", "", "Classify media and print its local dir")
+	flag.StringVar(&cli.Name, "c", "", "Classify media and print its local dir. Use - to classify names from stdin")
+	flag.StringVar(&cli.ClassifyDirs, "L", "", "Comma-separated list of local dirs to try when classifying")
+	flag.StringVar(&cli.Organize, "o", "", "Move existing media in given dir into the layout of local dirs")
+	flag.StringVar(&cli.Undo, "u", "", "Undo moves recorded in given journal")
+	flag.BoolVar(&cli.Progress, "P", false, "Show transfer progress instead of output from lftp")
+	flag.BoolVar(&cli.Resume, "r", false, "Resume unfinished transfers of the last run")
 	flag.Parse()
 	client := lftp.Client{Path: cli.LftpPath, InheritIO: !cli.Quiet}
+	if cli.Progress {
+		view := progressView{w: cli.stderr}
+		client.Progress = view.render
+	}
 	cli.lister = &client
 	cli.consumer = &client
 	if err := cli.Run(); err != nil {
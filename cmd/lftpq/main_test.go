@@ -2,12 +2,16 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/mpolden/lftpq/queue"
 )
 
 type file struct {
@@ -27,6 +31,7 @@ type testClient struct {
 	consumeQueue bool
 	failDirs     []string
 	dirList      []os.FileInfo
+	dirSizes     map[string]int64
 }
 
 func (c *testClient) Consume(path string) error {
@@ -45,6 +50,14 @@ func (c *testClient) List(name, path string) ([]os.FileInfo, error) {
 	return c.dirList, nil
 }
 
+func (c *testClient) DirSizes(name, path string) (map[string]int64, error) {
+	return c.dirSizes, nil
+}
+
+func (c *testClient) Cat(name, path string) ([]byte, error) {
+	return nil, fmt.Errorf("unexpected call with path=%s", path)
+}
+
 func writeTestConfig(config string) (string, error) {
 	f, err := ioutil.TempFile("", "lftpq")
 	if err != nil {
@@ -65,11 +78,12 @@ func newTestCLI(config string) (*CLI, *bytes.Buffer) {
 	var buf bytes.Buffer
 	client := testClient{consumeQueue: false}
 	return &CLI{
-		Config:   name,
-		stderr:   &buf,
-		stdout:   &buf,
-		consumer: &client,
-		lister:   &client,
+		Config:    name,
+		stateFile: name + ".state",
+		stderr:    &buf,
+		stdout:    &buf,
+		consumer:  &client,
+		lister:    &client,
 	}, &buf
 }
 
@@ -102,9 +116,17 @@ func TestConfigTest(t *testing.T) {
 	want := `{
   "Default": {
     "GetCmd": "",
+    "GetDirCmd": "",
+    "GetFileCmd": "",
+    "GetCmdOverrides": null,
     "Name": "",
     "Dirs": null,
+    "DaysBack": 0,
+    "MaxDepth": 0,
+    "DirSizes": false,
     "MaxAge": "",
+    "MinSize": "",
+    "MaxSize": "",
     "Patterns": null,
     "Filters": null,
     "SkipSymlinks": false,
@@ -112,16 +134,45 @@ func TestConfigTest(t *testing.T) {
     "SkipFiles": false,
     "LocalDir": "",
     "Priorities": null,
+    "PreferredGroups": null,
+    "BlockedGroups": null,
+    "Scores": null,
+    "Cutoff": {
+      "Field": "",
+      "Pattern": ""
+    },
+    "RateLimit": "",
+    "TransferWindows": null,
+    "CheckIncomplete": false,
+    "IncompleteTags": null,
+    "MinQuietAge": "",
+    "LftpSettings": null,
+    "Preamble": null,
+    "Epilogue": null,
+    "VerifyChecksums": false,
+    "RequeueFailed": false,
     "PostCommand": "",
     "Merge": false,
+    "DeleteSuperseded": false,
     "Skip": false
   },
+  "Parsers": null,
   "LocalDirs": [
     {
       "Name": "d1",
       "Parser": "movie",
       "Dir": "/tmp/",
-      "Replacements": []
+      "Replacements": [],
+      "Aliases": null,
+      "ParserTimeout": "",
+      "Sanitize": {
+        "Charset": "",
+        "Replacements": [],
+        "MaxLength": 0,
+        "Normalize": ""
+      },
+      "MinFreeSpace": "",
+      "ExtractCommand": ""
     }
   ],
   "Sites": []
@@ -186,10 +237,12 @@ t2 /baz/foo.2018
 queue mirror '/foo/bar.2017' '/tmp/bar.2017'
 queue start
 wait
+lftpq: t1: 1 items, 0 B
 open t2
 queue mirror '/baz/foo.2018' '/tmp/foo.2018'
 queue start
 wait
+lftpq: t2: 1 items, 0 B
 `
 	if got := buf.String(); got != want {
 		t.Errorf("want %s, got %s", want, got)
@@ -207,6 +260,7 @@ wait
     "RemotePath": "/foo/bar.2017",
     "LocalPath": "/tmp/bar.2017",
     "ModTime": "0001-01-01T00:00:00Z",
+    "Size": 0,
     "Transfer": true,
     "Reason": "Import=true",
     "Media": {
@@ -216,10 +270,26 @@ wait
       "Season": 0,
       "Episode": 0,
       "Resolution": "",
-      "Codec": ""
+      "Codec": "",
+      "Revision": 0,
+      "Group": "",
+      "Artist": "",
+      "Album": "",
+      "Format": "",
+      "Source": "",
+      "Edition": "",
+      "Extra": null,
+      "Segments": null
     },
     "Duplicate": false,
-    "Merged": false
+    "Merged": false,
+    "Delete": false,
+    "Score": 0,
+    "ScoreDetails": null,
+    "Verified": false,
+    "VerifyError": "",
+    "Extracted": null,
+    "ExtractError": ""
   }
 ]
 [
@@ -227,6 +297,7 @@ wait
     "RemotePath": "/baz/foo.2018",
     "LocalPath": "/tmp/foo.2018",
     "ModTime": "0001-01-01T00:00:00Z",
+    "Size": 0,
     "Transfer": true,
     "Reason": "Import=true",
     "Media": {
@@ -236,10 +307,26 @@ wait
       "Season": 0,
       "Episode": 0,
       "Resolution": "",
-      "Codec": ""
+      "Codec": "",
+      "Revision": 0,
+      "Group": "",
+      "Artist": "",
+      "Album": "",
+      "Format": "",
+      "Source": "",
+      "Edition": "",
+      "Extra": null,
+      "Segments": null
     },
     "Duplicate": false,
-    "Merged": false
+    "Merged": false,
+    "Delete": false,
+    "Score": 0,
+    "ScoreDetails": null,
+    "Verified": false,
+    "VerifyError": "",
+    "Extracted": null,
+    "ExtractError": ""
   }
 ]
 `
@@ -303,6 +390,7 @@ func TestRun(t *testing.T) {
 queue mirror '/baz/foo.2017' '/tmp/foo.2017'
 queue start
 wait
+lftpq: t1: 1 items, 0 B
 `
 	if got := buf.String(); got != want {
 		t.Errorf("want %s, got %s", want, got)
@@ -319,6 +407,7 @@ wait
     "RemotePath": "/baz/foo.2017",
     "LocalPath": "/tmp/foo.2017",
     "ModTime": "0001-01-01T00:00:00Z",
+    "Size": 0,
     "Transfer": true,
     "Reason": "Match=.*",
     "Media": {
@@ -328,10 +417,26 @@ wait
       "Season": 0,
       "Episode": 0,
       "Resolution": "",
-      "Codec": ""
+      "Codec": "",
+      "Revision": 0,
+      "Group": "",
+      "Artist": "",
+      "Album": "",
+      "Format": "",
+      "Source": "",
+      "Edition": "",
+      "Extra": null,
+      "Segments": null
     },
     "Duplicate": false,
-    "Merged": false
+    "Merged": false,
+    "Delete": false,
+    "Score": 0,
+    "ScoreDetails": null,
+    "Verified": false,
+    "VerifyError": "",
+    "Extracted": null,
+    "ExtractError": ""
   }
 ]
 `
@@ -340,6 +445,170 @@ wait
 	}
 }
 
+func TestRunDirSizes(t *testing.T) {
+	cli, buf := newTestCLI(`
+{
+  "LocalDirs": [
+    {
+      "Name": "d1",
+      "Parser": "movie",
+      "Dir": "/tmp/"
+    }
+  ],
+  "Sites": [
+    {
+      "LocalDir": "d1",
+      "GetCmd": "mirror",
+      "Patterns": [".*"],
+      "MaxAge": "0",
+      "Name": "t1",
+      "Dirs": ["/baz"],
+      "DirSizes": true,
+      "MinSize": "1GB"
+    }
+  ]
+}`)
+	defer os.Remove(cli.Config)
+	client := testClient{
+		dirList: []os.FileInfo{
+			file{name: "/baz/foo.2017", mode: os.ModeDir},
+			file{name: "/baz/bar.2017", mode: os.ModeDir},
+		},
+		dirSizes: map[string]int64{"/baz/foo.2017": 3 << 30, "/baz/bar.2017": 100 << 20, "/baz": 3<<30 + 100<<20},
+	}
+	cli.lister = &client
+	cli.Dryrun = true
+	if err := cli.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := `open t1
+queue mirror '/baz/foo.2017' '/tmp/foo.2017'
+queue start
+wait
+lftpq: t1: 1 items, 3.0 GiB
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestRunTransferWindow(t *testing.T) {
+	tomorrow := time.Now().AddDate(0, 0, 1).Weekday().String()
+	cli, buf := newTestCLI(`
+{
+  "LocalDirs": [
+    {
+      "Name": "d1",
+      "Parser": "movie",
+      "Dir": "/tmp/"
+    }
+  ],
+  "Sites": [
+    {
+      "LocalDir": "d1",
+      "GetCmd": "mirror",
+      "Patterns": [".*"],
+      "MaxAge": "0",
+      "Name": "t1",
+      "Dirs": ["/baz"],
+      "TransferWindows": [{"Days": ["` + tomorrow + `"]}]
+    }
+  ]
+}`)
+	defer os.Remove(cli.Config)
+	defer os.Remove(cli.stateFile)
+	// Client fails if queue is consumed
+	client := testClient{dirList: []os.FileInfo{file{name: "/baz/foo.2017"}}}
+	cli.lister = &client
+	cli.consumer = &client
+	if err := cli.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "lftpq: t1 queue deferred: outside transfer windows\n", buf.String(); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	// Deferred queues are kept for resuming
+	state, err := queue.ReadState(cli.stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Queues) != 1 || len(state.Queues[0].Items) != 1 || state.Queues[0].Items[0].Done {
+		t.Errorf("want one unfinished item in state, got %+v", state.Queues)
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	cli, buf := newTestCLI(`
+{
+  "LocalDirs": [
+    {
+      "Name": "d1",
+      "Parser": "movie",
+      "Dir": "/tmp/"
+    }
+  ],
+  "Default": {
+    "LocalDir": "d1",
+    "GetCmd": "mirror",
+    "Patterns": [".*"],
+    "MaxAge": "0",
+    "Dirs": ["/baz"]
+  },
+  "Sites": [{"Name": "t1"}]
+}`)
+	defer os.Remove(cli.Config)
+	defer os.Remove(cli.stateFile)
+
+	// Transfer fails and state is kept
+	client := testClient{dirList: []os.FileInfo{file{name: "/baz/foo.2017"}}}
+	cli.lister = &client
+	cli.consumer = &client
+	if err := cli.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cli.stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another run fails and keeps the unfinished item of the first run
+	client.dirList = []os.FileInfo{file{name: "/baz/bar.2018"}}
+	if err := cli.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resumed queue is built from state, not from listing
+	buf.Reset()
+	client.dirList = nil
+	cli.Resume = true
+	cli.Dryrun = true
+	if err := cli.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := `open t1
+queue mirror '/baz/bar.2018' '/tmp/bar.2018'
+queue mirror '/baz/foo.2017' '/tmp/foo.2017'
+queue start
+wait
+lftpq: t1: 2 items, 0 B
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	// Transfer succeeds and state is removed
+	cli.Dryrun = false
+	client.consumeQueue = true
+	if err := cli.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cli.stateFile); !os.IsNotExist(err) {
+		t.Fatalf("want state to be removed, got %v", err)
+	}
+	if err := cli.Run(); err == nil {
+		t.Fatal("want error when there is nothing to resume")
+	}
+}
+
 func TestRunSkipSite(t *testing.T) {
 	cli, buf := newTestCLI(`
 {
@@ -462,3 +731,116 @@ func TestClassify(t *testing.T) {
 		}
 	}
 }
+
+func TestClassifyStdin(t *testing.T) {
+	cli, buf := newTestCLI(`
+{
+  "LocalDirs": [
+    {
+      "Name": "d0",
+      "Dir": "/media/"
+    },
+    {
+      "Name": "d2",
+      "Parser": "movie",
+      "Dir": "/media/{{ .Year}}/"
+    },
+    {
+      "Name": "d3",
+      "Parser": "show",
+      "Dir": "/media/{{ .Name }}/S{{ .Season | Sprintf \"%02d\" }}/"
+    }
+  ]
+}`)
+	defer os.Remove(cli.Config)
+
+	cli.Name = "-"
+	cli.stdin = strings.NewReader("/download/foo.S01E01\n\n/download/foo.2018\nbar\n")
+	if err := cli.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name     string
+		localDir string
+		parser   string
+		path     string
+		err      string
+	}{
+		{"foo.S01E01", "d3", "show", "/media/Foo/S01/foo.S01E01", ""},
+		{"foo.2018", "d2", "movie", "/media/2018/foo.2018", ""},
+		{"bar", "d0", "", "/media/bar", ""},
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(tests) {
+		t.Fatalf("want %d lines, got %d: %q", len(tests), len(lines), buf.String())
+	}
+	for i, tt := range tests {
+		var got classification
+		if err := json.Unmarshal([]byte(lines[i]), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != tt.name || got.LocalDir != tt.localDir || got.Parser != tt.parser || got.Path != tt.path ||
+			got.Error != tt.err {
+			t.Errorf("#%d: want Name=%q LocalDir=%q Parser=%q Path=%q Error=%q, got %+v", i, tt.name, tt.localDir,
+				tt.parser, tt.path, tt.err, got)
+		}
+	}
+
+	// Constrain and reorder local dirs
+	buf.Reset()
+	cli.ClassifyDirs = "d2,d3"
+	cli.stdin = strings.NewReader("foo.S01E01.2018\nbar\n")
+	if err := cli.Run(); err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var movie, invalid classification
+	if err := json.Unmarshal([]byte(lines[0]), &movie); err != nil {
+		t.Fatal(err)
+	}
+	if want := "d2"; movie.LocalDir != want {
+		t.Errorf("want LocalDir=%q, got %q", want, movie.LocalDir)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &invalid); err != nil {
+		t.Fatal(err)
+	}
+	if want := `parsing failed: "bar"`; invalid.Error != want {
+		t.Errorf("want Error=%q, got %q", want, invalid.Error)
+	}
+
+	cli.ClassifyDirs = "d4"
+	if err := cli.Run(); err == nil {
+		t.Error("want error for invalid local dir")
+	}
+}
+
+func TestClassifyDirsOrder(t *testing.T) {
+	dirs := []queue.LocalDir{
+		{Name: "default", Parser: ""},
+		{Name: "custom1", Parser: "daily"},
+		{Name: "audiobooks", Parser: "audiobook"},
+		{Name: "music", Parser: "music"},
+		{Name: "custom2", Parser: "exec:/usr/bin/parser"},
+		{Name: "movies", Parser: "movie"},
+		{Name: "tv", Parser: "show"},
+		{Name: "tv-archive", Parser: "show"},
+	}
+	want := []string{"tv", "tv-archive", "movies", "music", "audiobooks", "custom1", "custom2", "default"}
+	cli := CLI{}
+	// Order does not depend on the initial order of local dirs with different parsers
+	for i := 0; i < 10; i++ {
+		sorted, err := cli.classifyDirs(dirs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, d := range sorted {
+			got = append(got, d.Name)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("want %q, got %q", want, got)
+		}
+		dirs[0], dirs[5] = dirs[5], dirs[0]
+		dirs[2], dirs[3] = dirs[3], dirs[2]
+	}
+}
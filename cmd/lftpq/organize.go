@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mpolden/lftpq/queue"
+)
+
+const journalName = ".lftpq-journal"
+
+type move struct {
+	From string
+	To   string
+}
+
+func (c *CLI) organize(dirs []queue.LocalDir) error {
+	dirs, err := c.classifyDirs(dirs)
+	if err != nil {
+		return err
+	}
+	// Local dirs without a parser accept any name, which would move everything into a single directory
+	var parsing []queue.LocalDir
+	for _, d := range dirs {
+		if d.Parser != "" {
+			parsing = append(parsing, d)
+		}
+	}
+	root := filepath.Clean(c.Organize)
+	moves, err := planMoves(root, parsing)
+	if err != nil {
+		return err
+	}
+	var journal *os.File
+	if !c.Dryrun && len(moves) > 0 {
+		journal, err = os.OpenFile(filepath.Join(root, journalName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer journal.Close()
+	}
+	for _, m := range moves {
+		if err := checkMove(m, moves); err != nil {
+			c.printf("conflict: %s -> %s: %s\n", m.From, m.To, err)
+			continue
+		}
+		if c.Dryrun {
+			fmt.Fprintf(c.stdout, "%s -> %s\n", m.From, m.To)
+			continue
+		}
+		if err := rename(m.From, m.To); err != nil {
+			return err
+		}
+		if err := json.NewEncoder(journal).Encode(m); err != nil {
+			return err
+		}
+		c.printf("%s -> %s\n", m.From, m.To)
+	}
+	return nil
+}
+
+func (c *CLI) undo() error {
+	f, err := os.Open(c.Undo)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var moves []move
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var m move
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return fmt.Errorf("invalid journal entry: %q: %w", scanner.Text(), err)
+		}
+		moves = append(moves, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for i := len(moves) - 1; i >= 0; i-- {
+		m := moves[i]
+		if c.Dryrun {
+			fmt.Fprintf(c.stdout, "%s -> %s\n", m.To, m.From)
+			continue
+		}
+		_, errFrom := os.Lstat(m.From)
+		_, errTo := os.Lstat(m.To)
+		switch {
+		case errFrom == nil && os.IsNotExist(errTo):
+			// Already reverted, e.g. by an earlier undo that did not finish
+		case errFrom == nil:
+			return fmt.Errorf("cannot undo %s -> %s: %s already exists", m.From, m.To, m.From)
+		default:
+			if err := rename(m.To, m.From); err != nil {
+				return err
+			}
+			c.printf("%s -> %s\n", m.To, m.From)
+		}
+		// Keep only the remaining entries, so that a failed undo can be run again
+		if err := writeJournal(c.Undo, moves[:i]); err != nil {
+			return err
+		}
+	}
+	if c.Dryrun {
+		return nil
+	}
+	return os.Remove(c.Undo)
+}
+
+func writeJournal(path string, moves []move) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, m := range moves {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func planMoves(dir string, dirs []queue.LocalDir) ([]move, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var moves []move
+	for _, fi := range entries {
+		if strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		result, err := classifyName(dirs, fi.Name())
+		if err != nil {
+			if fi.IsDir() {
+				// Not a release, but it may contain releases in an old layout
+				ms, err := planMoves(path, dirs)
+				if err != nil {
+					return nil, err
+				}
+				moves = append(moves, ms...)
+			}
+			continue
+		}
+		if to := filepath.Clean(result.Path); to != path {
+			moves = append(moves, move{From: path, To: to})
+		}
+	}
+	return moves, nil
+}
+
+func checkMove(m move, moves []move) error {
+	for _, o := range moves {
+		if o.To == m.To && o.From != m.From {
+			return fmt.Errorf("%s has the same destination", o.From)
+		}
+	}
+	if strings.HasPrefix(m.To, m.From+string(os.PathSeparator)) {
+		return fmt.Errorf("destination is inside source")
+	}
+	if _, err := os.Lstat(m.To); err == nil {
+		return fmt.Errorf("destination exists")
+	}
+	return nil
+}
+
+func rename(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mkdirs(t *testing.T, root string, dirs ...string) {
+	for _, d := range dirs {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func TestOrganize(t *testing.T) {
+	root, err := ioutil.TempDir("", "lftpq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	cli, buf := newTestCLI(`
+{
+  "LocalDirs": [
+    {
+      "Name": "tv",
+      "Parser": "show",
+      "Dir": "` + root + `/{{ .Name }}/S{{ .Season }}/"
+    },
+    {
+      "Name": "other",
+      "Parser": "",
+      "Dir": "` + root + `/other/"
+    }
+  ],
+  "Sites": []
+}
+`)
+	defer os.Remove(cli.Config)
+	mkdirs(t, root,
+		"old/The.Wire.S01E01",          // moved
+		"old/nested/The.Wire.S01E02",   // moved
+		"The.Wire/S1/The.Wire.S01E03",  // already organized
+		"a/Foo.S01E01", "b/Foo.S01E01", // same destination
+		"Bar.S01E01", "Bar/S1/Bar.S01E01/.placeholder", // destination exists
+		"not-media",
+	)
+
+	// Dry run prints plan and conflicts
+	cli.Organize = root
+	cli.Dryrun = true
+	if err := cli.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"lftpq: conflict: " + root + "/Bar.S01E01 -> " + root + "/Bar/S1/Bar.S01E01: destination exists",
+		"lftpq: conflict: " + root + "/a/Foo.S01E01 -> " + root + "/Foo/S1/Foo.S01E01: " + root + "/b/Foo.S01E01 has the same destination",
+		"lftpq: conflict: " + root + "/b/Foo.S01E01 -> " + root + "/Foo/S1/Foo.S01E01: " + root + "/a/Foo.S01E01 has the same destination",
+		root + "/old/The.Wire.S01E01 -> " + root + "/The.Wire/S1/The.Wire.S01E01",
+		root + "/old/nested/The.Wire.S01E02 -> " + root + "/The.Wire/S1/The.Wire.S01E02",
+	}
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("want\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	if !exists(filepath.Join(root, "old/The.Wire.S01E01")) {
+		t.Fatal("dry run moved directory")
+	}
+
+	// Execute
+	buf.Reset()
+	cli.Dryrun = false
+	if err := cli.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"The.Wire/S1/The.Wire.S01E01", "The.Wire/S1/The.Wire.S01E02", "a/Foo.S01E01", "b/Foo.S01E01", "Bar.S01E01"} {
+		if !exists(filepath.Join(root, path)) {
+			t.Errorf("want %s to exist", path)
+		}
+	}
+	for _, path := range []string{"old/The.Wire.S01E01", "old/nested/The.Wire.S01E02"} {
+		if exists(filepath.Join(root, path)) {
+			t.Errorf("want %s to be moved", path)
+		}
+	}
+
+	// Undo fails partway and can be run again
+	journal := filepath.Join(root, journalName)
+	blocker := filepath.Join(root, "old/The.Wire.S01E01")
+	mkdirs(t, root, "old/The.Wire.S01E01")
+	cli.Organize = ""
+	cli.Undo = journal
+	if err := cli.Run(); err == nil {
+		t.Fatal("want error when source exists")
+	}
+	if !exists(filepath.Join(root, "old/nested/The.Wire.S01E02")) {
+		t.Error("want old/nested/The.Wire.S01E02 to be restored")
+	}
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"old/The.Wire.S01E01", "old/nested/The.Wire.S01E02"} {
+		if !exists(filepath.Join(root, path)) {
+			t.Errorf("want %s to be restored", path)
+		}
+	}
+	if exists(journal) {
+		t.Error("want journal to be removed")
+	}
+}
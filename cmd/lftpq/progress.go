@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mpolden/lftpq/lftp"
+	"github.com/mpolden/lftpq/queue"
+)
+
+// progressView renders transfer events as a single status line, which is updated in place, and a line per finished
+// or failed transfer. Unrecognised output from lftp is printed as is
+type progressView struct {
+	w      io.Writer
+	status int // Length of the current status line
+}
+
+func (v *progressView) clear() {
+	if v.status > 0 {
+		fmt.Fprintf(v.w, "\r%s\r", strings.Repeat(" ", v.status))
+		v.status = 0
+	}
+}
+
+func (v *progressView) println(format string, args ...interface{}) {
+	v.clear()
+	fmt.Fprintf(v.w, "lftpq: "+format+"\n", args...)
+}
+
+func (v *progressView) render(ev lftp.Event) {
+	switch ev.Type {
+	case lftp.Started:
+		v.println("started %s", ev.Name)
+	case lftp.Progress:
+		line := fmt.Sprintf("lftpq: %s %d%% %s", ev.Name, ev.Percent, queue.FormatSize(ev.Bytes))
+		if ev.Rate > 0 {
+			line += fmt.Sprintf(" %s/s", queue.FormatSize(ev.Rate))
+		}
+		if ev.ETA > 0 {
+			line += fmt.Sprintf(" eta %s", ev.ETA)
+		}
+		v.clear()
+		fmt.Fprint(v.w, line)
+		v.status = len(line)
+	case lftp.Finished:
+		v.println("finished: %s", queue.FormatSize(ev.Bytes))
+	case lftp.Failed:
+		v.println("failed: %s: %s", ev.Name, ev.Message)
+	case lftp.Output:
+		v.clear()
+		fmt.Fprintln(v.w, ev.Message)
+	}
+}
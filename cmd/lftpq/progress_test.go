@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mpolden/lftpq/lftp"
+)
+
+func TestProgressView(t *testing.T) {
+	var buf bytes.Buffer
+	v := progressView{w: &buf}
+	v.render(lftp.Event{Type: lftp.Started, Name: "foo"})
+	v.render(lftp.Event{Type: lftp.Progress, Name: "foo", Bytes: 1 << 20, Percent: 50, Rate: 1 << 19, ETA: 2 * time.Second})
+	v.render(lftp.Event{Type: lftp.Progress, Name: "foo", Bytes: 2 << 20, Percent: 100})
+	v.render(lftp.Event{Type: lftp.Finished, Bytes: 2 << 20})
+	v.render(lftp.Event{Type: lftp.Failed, Name: "mirror", Message: "Access failed"})
+	v.render(lftp.Event{Type: lftp.Progress, Name: "bar", Percent: 1})
+	v.render(lftp.Event{Type: lftp.Output, Message: "open: Name or service not known"})
+	want := "lftpq: started foo\n" +
+		"lftpq: foo 50% 1.0 MiB 512.0 KiB/s eta 2s" +
+		"\r                                         \r" +
+		"lftpq: foo 100% 2.0 MiB" +
+		"\r                       \r" +
+		"lftpq: finished: 2.0 MiB\n" +
+		"lftpq: failed: mirror: Access failed\n" +
+		"lftpq: bar 1% 0 B" +
+		"\r                 \r" +
+		"open: Name or service not known\n"
+	if got := buf.String(); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
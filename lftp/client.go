@@ -2,19 +2,27 @@ package lftp
 
 import (
 	"bufio"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 )
 
 type Client struct {
 	Path      string
 	InheritIO bool
+	// Progress receives events parsed from the output of lftp. If set, output is parsed instead of inherited.
+	Progress func(Event)
 }
 
 func (c *Client) Consume(name string) error {
-	cmd := exec.Command(c.Path, "-f", name)
+	cmd := exec.Command(c.Path, consumeArgs(name, c.Progress != nil)...)
+	if c.Progress != nil {
+		return c.consumeEvents(cmd)
+	}
 	if c.InheritIO {
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -25,6 +33,38 @@ func (c *Client) Consume(name string) error {
 	return cmd.Wait()
 }
 
+func (c *Client) consumeEvents(cmd *exec.Cmd) error {
+	r, w := io.Pipe()
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		err := readEvents(r, c.Progress)
+		io.Copy(ioutil.Discard, r) // Avoid blocking lftp if reading fails
+		done <- err
+	}()
+	err := cmd.Wait()
+	w.Close()
+	if readErr := <-done; err == nil {
+		err = readErr
+	}
+	return err
+}
+
+// consumeArgs returns the arguments for running the script name. lftp only prints status lines when it considers itself
+// interactive, which it does not when its output is piped, so this is forced when progress is parsed. Settings in the
+// script itself take precedence.
+func consumeArgs(name string, progress bool) []string {
+	if !progress {
+		return []string{"-f", name}
+	}
+	script := "set cmd:interactive true; set cmd:status-interval 1s; source '" + strings.Replace(name, "'", "\\'", -1) + "'"
+	return []string{"-c", script}
+}
+
 func (c *Client) List(site, path string) ([]os.FileInfo, error) {
 	cmd := exec.Command(c.Path, listArgs(site, path)...)
 
@@ -67,6 +107,69 @@ func parseDirList(r io.Reader) ([]os.FileInfo, error) {
 }
 
 func listArgs(name, path string) []string {
-	script := "cls -1 --classify --date --time-style='%s' " + path + " && exit"
+	script := "cls -1 --classify --size --block-size=1 --date --time-style='%s' " + path + " && exit"
+	return []string{"-e", script, name}
+}
+
+// DirSizes returns the total size of each directory in path, as reported by du. This traverses the entire tree below
+// path.
+func (c *Client) DirSizes(site, path string) (map[string]int64, error) {
+	cmd := exec.Command(c.Path, duArgs(site, path)...)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	sizes, err := parseDirSizes(stdout)
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, err
+	}
+	return sizes, nil
+}
+
+func parseDirSizes(r io.Reader) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid size: %q", line)
+		}
+		size, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size: %q: %s", parts[0], err)
+		}
+		sizes[strings.TrimRight(parts[1], "/")] = size
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sizes, nil
+}
+
+func duArgs(name, path string) []string {
+	script := "du --bytes --max-depth=1 " + path + " && exit"
+	return []string{"-e", script, name}
+}
+
+// Cat returns the contents of the file at path.
+func (c *Client) Cat(site, path string) ([]byte, error) {
+	cmd := exec.Command(c.Path, catArgs(site, path)...)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
+
+func catArgs(name, path string) []string {
+	script := "cat " + path + " && exit"
 	return []string{"-e", script, name}
 }
@@ -8,9 +8,9 @@ import (
 )
 
 func TestParseDirList(t *testing.T) {
-	ls := `1403705716 dir1/
-	1422918075 dir2/
-	1426408110 dir3@`
+	ls := `4096 1403705716 dir1/
+	4096 1422918075 dir2/
+	14 1426408110 dir3@`
 	want := []file{
 		{modTime: time.Date(2014, 6, 25, 14, 15, 16, 0, time.UTC), path: "dir1"},
 		{modTime: time.Date(2015, 2, 2, 23, 1, 15, 0, time.UTC), path: "dir2"},
@@ -29,9 +29,57 @@ func TestParseDirList(t *testing.T) {
 }
 
 func TestListArgs(t *testing.T) {
-	want := []string{"-e", "cls -1 --classify --date --time-style='%s' /foo && exit", "bar"}
+	want := []string{"-e", "cls -1 --classify --size --block-size=1 --date --time-style='%s' /foo && exit", "bar"}
 	got := listArgs("bar", "/foo")
 	if !reflect.DeepEqual(want, got) {
 		t.Fatalf("want %q, got %s", want, got)
 	}
 }
+
+func TestConsumeArgs(t *testing.T) {
+	var tests = []struct {
+		name     string
+		progress bool
+		out      []string
+	}{
+		{"/tmp/lftpq1", false, []string{"-f", "/tmp/lftpq1"}},
+		{"/tmp/lftpq1", true, []string{"-c", "set cmd:interactive true; set cmd:status-interval 1s; source '/tmp/lftpq1'"}},
+		{"/tmp/it's", true, []string{"-c", "set cmd:interactive true; set cmd:status-interval 1s; source '/tmp/it\\'s'"}},
+	}
+	for _, tt := range tests {
+		if got := consumeArgs(tt.name, tt.progress); !reflect.DeepEqual(tt.out, got) {
+			t.Errorf("consumeArgs(%q, %t) = %q, want %q", tt.name, tt.progress, got, tt.out)
+		}
+	}
+}
+
+func TestParseDirSizes(t *testing.T) {
+	du := "1024\t/foo/dir1\n2048\t/foo/dir2/\n3072\t/foo\n"
+	want := map[string]int64{"/foo/dir1": 1024, "/foo/dir2": 2048, "/foo": 3072}
+	got, err := parseDirSizes(strings.NewReader(du))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	if _, err := parseDirSizes(strings.NewReader("foo\t/bar")); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestDuArgs(t *testing.T) {
+	want := []string{"-e", "du --bytes --max-depth=1 /foo && exit", "bar"}
+	got := duArgs("bar", "/foo")
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %q, got %s", want, got)
+	}
+}
+
+func TestCatArgs(t *testing.T) {
+	want := []string{"-e", "cat /foo/foo.sfv && exit", "bar"}
+	got := catArgs("bar", "/foo/foo.sfv")
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("want %q, got %s", want, got)
+	}
+}
@@ -10,28 +10,42 @@ import (
 
 type file struct {
 	path    string
+	size    int64
 	modTime time.Time
 	mode    os.FileMode
 }
 
 func (f file) Name() string       { return f.path }
-func (f file) Size() int64        { return 0 }
+func (f file) Size() int64        { return f.size }
 func (f file) Mode() os.FileMode  { return f.mode }
 func (f file) ModTime() time.Time { return f.modTime }
 func (f file) IsDir() bool        { return f.Mode().IsDir() }
 func (f file) Sys() interface{}   { return nil }
 
+func cutField(s string) (string, string) {
+	i := strings.IndexByte(s, ' ')
+	if i == -1 {
+		return s, ""
+	}
+	return s[:i], strings.TrimLeft(s[i+1:], " ")
+}
+
+// ParseFile parses a line from the output of cls. The line is on the form "<size> <time> <path>".
 func ParseFile(s string) (file, error) {
-	parts := strings.SplitN(s, " ", 2)
-	if len(parts) != 2 {
+	sizeField, rest := cutField(strings.TrimLeft(s, " "))
+	timeField, path := cutField(rest)
+	if path == "" {
 		return file{}, fmt.Errorf("invalid file: %q", s)
 	}
-	secs, err := strconv.ParseInt(parts[0], 10, 64)
+	size, err := strconv.ParseInt(sizeField, 10, 64)
 	if err != nil {
-		return file{}, fmt.Errorf("invalid time: %q: %s", parts[0], err)
+		return file{}, fmt.Errorf("invalid size: %q: %s", sizeField, err)
+	}
+	secs, err := strconv.ParseInt(timeField, 10, 64)
+	if err != nil {
+		return file{}, fmt.Errorf("invalid time: %q: %s", timeField, err)
 	}
 	modified := time.Unix(secs, 0)
-	path := parts[1]
 
 	var fileMode os.FileMode
 	if strings.HasSuffix(path, "@") {
@@ -39,10 +53,15 @@ func ParseFile(s string) (file, error) {
 	} else if strings.HasSuffix(path, "/") {
 		fileMode = os.ModeDir
 	}
+	// The size of a directory or symlink entry says nothing about its contents
+	if fileMode != 0 {
+		size = 0
+	}
 
 	path = strings.TrimRight(path, "@/")
 	return file{
 		path:    path,
+		size:    size,
 		modTime: modified,
 		mode:    fileMode,
 	}, nil
@@ -16,14 +16,18 @@ func TestParseFile(t *testing.T) {
 		IsDir     bool
 		IsRegular bool
 	}{
-		{"1418688270 /bar/foo/", file{modTime: t1, path: "/bar/foo"},
+		{"4096 1418688270 /bar/foo/", file{modTime: t1, path: "/bar/foo"},
 			false /* IsDir */, true, false},
-		{"1422976350 /foo/bar@",
+		{"9 1422976350 /foo/bar@",
 			file{modTime: t2, path: "/foo/bar"} /* IsSymlink */, true, false, false},
-		{"1418688270 /foo/bar baz/",
+		{"4096 1418688270 /foo/bar baz/",
 			file{modTime: t1, path: "/foo/bar baz"}, false /* IsDir */, true, false},
-		{"1418688270 /foo/baz",
+		{"0 1418688270 /foo/baz",
 			file{modTime: t1, path: "/foo/baz"}, false, false /* IsRegular */, true},
+		{"  1048576 1418688270 /foo/bar baz.mkv",
+			file{modTime: t1, path: "/foo/bar baz.mkv", size: 1048576}, false, false /* IsRegular */, true},
+		{"1 1418688270 1418688270",
+			file{modTime: t1, path: "1418688270", size: 1}, false, false /* IsRegular */, true},
 	}
 	for _, tt := range tests {
 		f, err := ParseFile(tt.in)
@@ -34,6 +38,9 @@ func TestParseFile(t *testing.T) {
 		if f.Name() != tt.out.Name() {
 			t.Errorf("Expected %q, got %q", tt.out.Name(), f.Name())
 		}
+		if f.Size() != tt.out.Size() {
+			t.Errorf("Expected size %d, got %d", tt.out.Size(), f.Size())
+		}
 		if !f.ModTime().Equal(tt.out.ModTime()) {
 			t.Errorf("Expected %s, got %s", tt.out.ModTime(), f.ModTime())
 		}
@@ -47,4 +54,9 @@ func TestParseFile(t *testing.T) {
 			t.Errorf("Expected IsRegular=%t, got %t", tt.IsRegular, f.Mode().IsRegular())
 		}
 	}
+	for _, in := range []string{"1418688270 /foo/bar", "4096 /foo/bar", "4096 1418688270", ""} {
+		if _, err := ParseFile(in); err == nil {
+			t.Errorf("Expected error for %q", in)
+		}
+	}
 }
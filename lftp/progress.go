@@ -0,0 +1,146 @@
+package lftp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type EventType int
+
+const (
+	Started EventType = iota
+	Progress
+	Finished
+	Failed
+	Output
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Started:
+		return "started"
+	case Progress:
+		return "progress"
+	case Finished:
+		return "finished"
+	case Failed:
+		return "failed"
+	case Output:
+		return "output"
+	}
+	return "unknown"
+}
+
+// Event is a transfer event parsed from the output of lftp
+type Event struct {
+	Type    EventType
+	Name    string
+	Bytes   int64
+	Percent int
+	Rate    int64 // Bytes per second
+	ETA     time.Duration
+	Message string
+}
+
+var (
+	startedPattern  = regexp.MustCompile("^Transferring file `(.+)'$")
+	progressPattern = regexp.MustCompile("^`(.+)' at (\\d+) \\((\\d+)%\\)(?: ([\\d.]+[KMGT]?)(?:/s)?)?(?: eta:(\\S+))?")
+	finishedPattern = regexp.MustCompile(`^(\d+) bytes transferred`)
+	failedPattern   = regexp.MustCompile(`(?i)^(\S+): (.*(?:failed|error|fatal|not connected).*)$`)
+)
+
+// parseRate parses a rate as printed by lftp, e.g. 1.5M, into bytes
+func parseRate(s string) int64 {
+	n := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		n = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		n = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		n = 1 << 30
+	case strings.HasSuffix(s, "T"):
+		n = 1 << 40
+	}
+	f, err := strconv.ParseFloat(strings.TrimRight(s, "KMGT"), 64)
+	if err != nil {
+		return 0
+	}
+	return int64(f * float64(n))
+}
+
+// parseETA parses an ETA as printed by lftp, e.g. 1h5m or 2d3h
+func parseETA(s string) time.Duration {
+	var d time.Duration
+	if i := strings.Index(s, "d"); i > -1 {
+		days, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0
+		}
+		d = time.Duration(days) * 24 * time.Hour
+		s = s[i+1:]
+	}
+	if s == "" {
+		return d
+	}
+	rest, err := time.ParseDuration(s)
+	if err != nil {
+		return 0
+	}
+	return d + rest
+}
+
+// ParseEvent parses a line of lftp output. The second return value is false if line does not contain an event.
+func ParseEvent(line string) (Event, bool) {
+	line = strings.TrimSpace(line)
+	if m := startedPattern.FindStringSubmatch(line); m != nil {
+		return Event{Type: Started, Name: m[1]}, true
+	}
+	if m := progressPattern.FindStringSubmatch(line); m != nil {
+		bytes, _ := strconv.ParseInt(m[2], 10, 64)
+		percent, _ := strconv.Atoi(m[3])
+		return Event{Type: Progress, Name: m[1], Bytes: bytes, Percent: percent, Rate: parseRate(m[4]), ETA: parseETA(m[5])}, true
+	}
+	if m := finishedPattern.FindStringSubmatch(line); m != nil {
+		bytes, _ := strconv.ParseInt(m[1], 10, 64)
+		return Event{Type: Finished, Bytes: bytes, Message: line}, true
+	}
+	if m := failedPattern.FindStringSubmatch(line); m != nil {
+		return Event{Type: Failed, Name: m[1], Message: m[2]}, true
+	}
+	return Event{}, false
+}
+
+// scanLines splits on both carriage returns and newlines, as lftp uses carriage returns to update status lines
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// readEvents calls f with the event of each line read from r. Non-empty lines that do not contain an event are passed
+// on as Output events, so that unrecognised messages and errors are not lost.
+func readEvents(r io.Reader, f func(Event)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(scanLines)
+	for scanner.Scan() {
+		if ev, ok := ParseEvent(scanner.Text()); ok {
+			f(ev)
+		} else if line := strings.TrimSpace(scanner.Text()); line != "" {
+			f(Event{Type: Output, Message: line})
+		}
+	}
+	return scanner.Err()
+}
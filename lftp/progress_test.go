@@ -0,0 +1,70 @@
+package lftp
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEvent(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out Event
+		ok  bool
+	}{
+		{"Transferring file `The.Wire.S01E01/the.wire.s01e01.r00'", Event{Type: Started, Name: "The.Wire.S01E01/the.wire.s01e01.r00"}, true},
+		{"`the.wire.s01e01.r00' at 10485760 (20%) 1.5M/s eta:30s [Receiving data]",
+			Event{Type: Progress, Name: "the.wire.s01e01.r00", Bytes: 10485760, Percent: 20, Rate: 1572864, ETA: 30 * time.Second}, true},
+		{"`foo' at 1024 (1%) 512/s eta:1d2h [Receiving data]",
+			Event{Type: Progress, Name: "foo", Bytes: 1024, Percent: 1, Rate: 512, ETA: 26 * time.Hour}, true},
+		{"`foo' at 0 (0%) [Connecting...]", Event{Type: Progress, Name: "foo"}, true},
+		{"52428800 bytes transferred in 35 seconds (1.43 MiB/s)",
+			Event{Type: Finished, Bytes: 52428800, Message: "52428800 bytes transferred in 35 seconds (1.43 MiB/s)"}, true},
+		{"mirror: Access failed: 550 /foo: No such file or directory",
+			Event{Type: Failed, Name: "mirror", Message: "Access failed: 550 /foo: No such file or directory"}, true},
+		{"Total: 1 directory, 5 files, 0 symlinks", Event{}, false},
+		{"", Event{}, false},
+	}
+	for _, tt := range tests {
+		ev, ok := ParseEvent(tt.in)
+		if ok != tt.ok {
+			t.Errorf("ParseEvent(%q) ok = %t, want %t", tt.in, ok, tt.ok)
+		}
+		if !reflect.DeepEqual(ev, tt.out) {
+			t.Errorf("ParseEvent(%q) = %+v, want %+v", tt.in, ev, tt.out)
+		}
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	out := "Transferring file `foo'\r`foo' at 1 (50%)\r`foo' at 2 (100%)\n2 bytes transferred\n\n" +
+		"open: mirror.example.com: Name or service not known\n"
+	var events []Event
+	if err := readEvents(strings.NewReader(out), func(ev Event) { events = append(events, ev) }); err != nil {
+		t.Fatal(err)
+	}
+	var types []EventType
+	for _, ev := range events {
+		types = append(types, ev.Type)
+	}
+	if want := []EventType{Started, Progress, Progress, Finished, Output}; !reflect.DeepEqual(want, types) {
+		t.Fatalf("want %v, got %v", want, types)
+	}
+	if want := "open: mirror.example.com: Name or service not known"; events[4].Message != want {
+		t.Errorf("want %q, got %q", want, events[4].Message)
+	}
+}
+
+func TestConsumeEvents(t *testing.T) {
+	var events []Event
+	c := Client{Progress: func(ev Event) { events = append(events, ev) }}
+	cmd := exec.Command("sh", "-c", "echo 'Transferring file `foo'\"'\"; echo 'get: Fatal error: max-retries exceeded' >&2")
+	if err := c.consumeEvents(cmd); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Type != Started || events[1].Type != Failed {
+		t.Errorf("got unexpected events: %+v", events)
+	}
+}
@@ -0,0 +1,182 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Command is a parser backed by a long-lived external program. Release names are written to the program as JSON
+// lines, e.g. {"Release":"The.Wire.S01E01"}, and the program replies with one JSON-encoded Media per line, in the
+// same order. A reply can set the field Error to signal that the release could not be parsed.
+type Command struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	env    []string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	lines  chan []byte
+	parsed map[string]result
+}
+
+type result struct {
+	media Media
+	err   error
+}
+
+type commandRequest struct {
+	Release string
+}
+
+type commandReply struct {
+	Media
+	Error string
+}
+
+func NewCommand(path string, args []string, timeout time.Duration) *Command {
+	return &Command{Path: path, Args: args, Timeout: timeout, parsed: make(map[string]result)}
+}
+
+func (c *Command) Parse(s string) (Media, error) {
+	if err := c.ParseAll([]string{s}); err != nil {
+		return Media{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := c.parsed[s]
+	return r.media, r.err
+}
+
+// ParseAll sends all unparsed names to the program in a single batch. Results are cached and returned by subsequent
+// calls to Parse.
+func (c *Command) ParseAll(names []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var batch []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if _, ok := c.parsed[name]; ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		batch = append(batch, name)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := c.start(); err != nil {
+		return err
+	}
+	stdin := c.stdin
+	go func() {
+		enc := json.NewEncoder(stdin)
+		for _, name := range batch {
+			if err := enc.Encode(commandRequest{Release: name}); err != nil {
+				return
+			}
+		}
+	}()
+	for _, name := range batch {
+		select {
+		case line, ok := <-c.lines:
+			if !ok {
+				c.stop()
+				return fmt.Errorf("%s: exited unexpectedly", c.Path)
+			}
+			var reply commandReply
+			if err := json.Unmarshal(line, &reply); err != nil {
+				c.stop()
+				return fmt.Errorf("%s: invalid reply: %q: %w", c.Path, line, err)
+			}
+			if reply.Error != "" {
+				c.parsed[name] = result{err: fmt.Errorf("invalid input: %q: %s", name, reply.Error)}
+				continue
+			}
+			if reply.Media.Release == "" {
+				reply.Media.Release = name
+			}
+			c.parsed[name] = result{media: reply.Media}
+		case <-time.After(c.Timeout):
+			c.stop()
+			err := fmt.Errorf("%s: timed out after %s while parsing %q", c.Path, c.Timeout, name)
+			// Fail the remaining names of the batch, instead of waiting for a timeout when they are parsed one by one
+			for _, name := range batch {
+				if _, ok := c.parsed[name]; !ok {
+					c.parsed[name] = result{err: err}
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the program, if it is running.
+func (c *Command) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.stop()
+	// The program is killed when stopped
+	if _, ok := err.(*exec.ExitError); ok {
+		return nil
+	}
+	return err
+}
+
+func (c *Command) start() error {
+	if c.cmd != nil {
+		return nil
+	}
+	cmd := exec.Command(c.Path, c.Args...)
+	cmd.Env = c.env
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			lines <- append([]byte(nil), scanner.Bytes()...)
+		}
+	}()
+	c.cmd = cmd
+	c.stdin = stdin
+	c.lines = lines
+	return nil
+}
+
+func (c *Command) stop() error {
+	if c.cmd == nil {
+		return nil
+	}
+	c.stdin.Close()
+	c.cmd.Process.Kill()
+	// Drain any pending output so that the reading goroutine can exit
+	go func(lines chan []byte) {
+		for range lines {
+		}
+	}(c.lines)
+	err := c.cmd.Wait()
+	c.cmd = nil
+	c.stdin = nil
+	c.lines = nil
+	return err
+}
@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCommand(timeout time.Duration) *Command {
+	c := NewCommand(os.Args[0], []string{"-test.run=TestCommandHelperProcess", "--"}, timeout)
+	c.env = append(os.Environ(), "LFTPQ_TEST_PARSER=1")
+	return c
+}
+
+func TestCommandHelperProcess(t *testing.T) {
+	if os.Getenv("LFTPQ_TEST_PARSER") != "1" {
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	n := 0
+	for scanner.Scan() {
+		var req struct{ Release string }
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			os.Exit(1)
+		}
+		n++
+		switch {
+		case strings.HasPrefix(req.Release, "slow"):
+			time.Sleep(500 * time.Millisecond)
+		case req.Release == "invalid":
+			enc.Encode(map[string]string{"Error": "unknown format"})
+		default:
+			parts := strings.SplitN(req.Release, ".", 2)
+			enc.Encode(map[string]interface{}{
+				"Name":  parts[0],
+				"Extra": map[string]string{"n": strconv.Itoa(n)},
+			})
+		}
+	}
+	os.Exit(0)
+}
+
+func TestCommand(t *testing.T) {
+	c := newTestCommand(5 * time.Second)
+	defer c.Close()
+	if err := c.ParseAll([]string{"foo.1", "bar.2", "foo.1"}); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		in   string
+		name string
+		n    string
+	}{
+		{"foo.1", "foo", "1"},
+		{"bar.2", "bar", "2"},
+		{"baz.3", "baz", "3"},
+		{"foo.1", "foo", "1"}, // Cached
+	}
+	for _, tt := range tests {
+		m, err := c.Parse(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Release != tt.in || m.Name != tt.name || m.Extra["n"] != tt.n {
+			t.Errorf("Expected Release=%s Name=%s n=%s, got %+v", tt.in, tt.name, tt.n, m)
+		}
+	}
+	want := `invalid input: "invalid": unknown format`
+	if _, err := c.Parse("invalid"); err == nil || err.Error() != want {
+		t.Errorf("Expected error %q, got %v", want, err)
+	}
+}
+
+func TestCommandClose(t *testing.T) {
+	c := newTestCommand(5 * time.Second)
+	if _, err := c.Parse("foo.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.cmd != nil {
+		t.Error("Expected program to be stopped")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	c := newTestCommand(10 * time.Millisecond)
+	defer c.Close()
+	if _, err := c.Parse("slow"); err == nil {
+		t.Fatal("Expected error")
+	}
+	// Remaining names in a batch fail without waiting for another timeout
+	if err := c.ParseAll([]string{"slow.1", "foo.2"}); err == nil {
+		t.Fatal("Expected error")
+	}
+	c.Timeout = 5 * time.Second
+	if _, err := c.Parse("foo.2"); err == nil {
+		t.Error("Expected cached error")
+	}
+	// Command is restarted after a timeout
+	m, err := c.Parse("foo.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Extra["n"] != "1" {
+		t.Errorf("Expected new process, got %+v", m)
+	}
+}
@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	movieTokenPattern = regexp.MustCompile(`[^\s._()\[\]-]+`)
+	qualityTokens     = map[string]bool{
+		"480p": true, "576p": true, "720p": true, "1080p": true, "2160p": true, "uhd": true, "hdr": true,
+		"bluray": true, "bdrip": true, "brrip": true, "web": true, "webrip": true, "webdl": true, "hdtv": true,
+		"dvdrip": true, "dvdr": true, "dvd": true, "remux": true, "hdrip": true,
+		"x264": true, "x265": true, "h264": true, "h265": true, "hevc": true, "xvid": true,
+		"proper": true, "repack": true, "limited": true, "internal": true,
+	}
+	editions = []edition{
+		{[]string{"directors", "cut"}, "Directors.Cut"},
+		{[]string{"final", "cut"}, "Final.Cut"},
+		{[]string{"special", "edition"}, "Special.Edition"},
+		{[]string{"extended"}, "Extended"},
+		{[]string{"theatrical"}, "Theatrical"},
+		{[]string{"unrated"}, "Unrated"},
+		{[]string{"uncut"}, "Uncut"},
+		{[]string{"remastered"}, "Remastered"},
+		{[]string{"imax"}, "IMAX"},
+		{[]string{"criterion"}, "Criterion"},
+	}
+)
+
+type edition struct {
+	words []string
+	name  string
+}
+
+func (e edition) match(words []string) bool {
+	if len(words) < len(e.words) {
+		return false
+	}
+	for i, w := range e.words {
+		if words[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+func Movie(s string) (Media, error) {
+	// The release year is the last plausible year before any quality token. This handles titles that start with or
+	// contain a year, such as 2001.A.Space.Odyssey.1968 or Blade.Runner.2049.2017
+	tokens := movieTokenPattern.FindAllStringIndex(s, -1)
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		words[i] = strings.ToLower(s[t[0]:t[1]])
+	}
+	maxYear := time.Now().Year() + 1
+	yearIndex := -1
+	year := 0
+	for i, word := range words {
+		if i == 0 {
+			continue // Title cannot be empty
+		}
+		if yearIndex != -1 && qualityTokens[word] {
+			break
+		}
+		if len(word) != 4 {
+			continue
+		}
+		if n, err := strconv.Atoi(word); err == nil && n >= 1888 && n <= maxYear {
+			yearIndex = i
+			year = n
+		}
+	}
+	if yearIndex == -1 {
+		return Media{}, fmt.Errorf("invalid input: %q", s)
+	}
+	name := strings.TrimRight(s[:tokens[yearIndex][0]], " ._-([")
+	if name == "" {
+		return Media{}, fmt.Errorf("invalid input: %q", s)
+	}
+	m := Media{
+		Release:    s,
+		Name:       name,
+		Year:       year,
+		Resolution: resolution(s),
+		Codec:      codec(s),
+		Revision:   revision(s[len(name):]),
+		Group:      group(s),
+	}
+	for i := yearIndex + 1; i < len(words) && m.Edition == ""; i++ {
+		for _, e := range editions {
+			if e.match(words[i:]) {
+				m.Edition = e.name
+				break
+			}
+		}
+	}
+	return m, nil
+}
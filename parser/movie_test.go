@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMovie(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out Media
+	}{
+		{"Apocalypse.Now.1979.1080p.x264.BluRay-GRP",
+			Media{
+				Release:    "Apocalypse.Now.1979.1080p.x264.BluRay-GRP",
+				Group:      "GRP",
+				Name:       "Apocalypse.Now",
+				Year:       1979,
+				Resolution: "1080p",
+				Codec:      "x264",
+			}},
+		{"2001.A.Space.Odyssey.1968.1080p.BluRay.x264-GRP",
+			Media{
+				Release:    "2001.A.Space.Odyssey.1968.1080p.BluRay.x264-GRP",
+				Group:      "GRP",
+				Name:       "2001.A.Space.Odyssey",
+				Year:       1968,
+				Resolution: "1080p",
+				Codec:      "x264",
+			}},
+		{"Blade.Runner.2049.2017.2160p.UHD.BluRay.x265-GRP",
+			Media{
+				Release:    "Blade.Runner.2049.2017.2160p.UHD.BluRay.x265-GRP",
+				Group:      "GRP",
+				Name:       "Blade.Runner.2049",
+				Year:       2017,
+				Resolution: "2160p",
+				Codec:      "x265",
+			}},
+		{"1917.2019.720p.BluRay.x264-GRP",
+			Media{
+				Release:    "1917.2019.720p.BluRay.x264-GRP",
+				Group:      "GRP",
+				Name:       "1917",
+				Year:       2019,
+				Resolution: "720p",
+				Codec:      "x264",
+			}},
+		{"The Matrix (1999) 1080p",
+			Media{
+				Release:    "The Matrix (1999) 1080p",
+				Name:       "The Matrix",
+				Year:       1999,
+				Resolution: "1080p",
+			}},
+		{"The.Web.2010.720p.WEB.x264-GRP",
+			Media{
+				Release:    "The.Web.2010.720p.WEB.x264-GRP",
+				Group:      "GRP",
+				Name:       "The.Web",
+				Year:       2010,
+				Resolution: "720p",
+				Codec:      "x264",
+			}},
+		{"Apocalypse.Now.1979.Final.Cut.REPACK.1080p.BluRay.x264-GRP",
+			Media{
+				Release:    "Apocalypse.Now.1979.Final.Cut.REPACK.1080p.BluRay.x264-GRP",
+				Group:      "GRP",
+				Name:       "Apocalypse.Now",
+				Year:       1979,
+				Resolution: "1080p",
+				Codec:      "x264",
+				Revision:   1,
+				Edition:    "Final.Cut",
+			}},
+		{"Blade Runner (1982) [Directors Cut] 720p",
+			Media{
+				Release:    "Blade Runner (1982) [Directors Cut] 720p",
+				Name:       "Blade Runner",
+				Year:       1982,
+				Resolution: "720p",
+				Edition:    "Directors.Cut",
+			}},
+		{"bar.2017",
+			Media{
+				Release: "bar.2017",
+				Name:    "bar",
+				Year:    2017,
+			}},
+	}
+	for _, tt := range tests {
+		got, err := Movie(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("Expected %+v, got %+v", tt.out, got)
+		}
+	}
+}
+
+func TestMovieFail(t *testing.T) {
+	for _, in := range []string{"foo", "2019.1080p", "Blade.Runner.2049.1080p"} {
+		if _, err := Movie(in); err == nil {
+			t.Errorf("Expected error for %q", in)
+		}
+	}
+}
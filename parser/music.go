@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	musicCodecs = map[string]string{
+		"flac": "FLAC", "mp3": "MP3", "aac": "AAC", "alac": "ALAC", "ogg": "OGG", "opus": "OPUS", "wav": "WAV",
+	}
+	musicBitrates = map[string]string{
+		"320": "320", "256": "256", "192": "192", "v0": "V0", "v2": "V2", "24bit": "24BIT",
+	}
+	musicSources = map[string]string{
+		"web": "WEB", "cd": "CD", "cdr": "CD", "cdm": "CD", "cds": "CD", "vinyl": "VINYL", "vls": "VINYL",
+		"lp": "VINYL", "dvd": "DVD", "sat": "SAT", "fm": "FM", "cable": "CABLE", "line": "LINE", "dab": "DAB",
+	}
+	audiobookTags = map[string]bool{"audiobook": true, "abook": true}
+)
+
+func Music(s string) (Media, error) { return music(s, false) }
+
+func Audiobook(s string) (Media, error) { return music(s, true) }
+
+func music(s string, audiobook bool) (Media, error) {
+	// Release names have the form Artist-Album-[Tags-]Year[-Group], where fields are separated by - or _-_
+	parts := strings.Split(strings.ReplaceAll(s, "_-_", "-"), "-")
+	yearIndex := -1
+	for i := len(parts) - 1; i > 1; i-- {
+		if isYear(parts[i]) {
+			yearIndex = i
+			break
+		}
+	}
+	if yearIndex == -1 || parts[0] == "" || parts[1] == "" {
+		return Media{}, fmt.Errorf("invalid input: %q", s)
+	}
+	year, _ := strconv.Atoi(parts[yearIndex])
+	m := Media{
+		Release: s,
+		Artist:  parts[0],
+		Album:   parts[1],
+		Year:    year,
+	}
+	if yearIndex < len(parts)-1 {
+		m.Group = parts[len(parts)-1]
+	}
+	var bitrate string
+	for _, tag := range parts[2:yearIndex] {
+		for _, part := range splitPattern.Split(strings.ToLower(tag), -1) {
+			if audiobookTags[part] && !audiobook {
+				return Media{}, fmt.Errorf("invalid input: %q: audiobook", s)
+			}
+			if codec, ok := musicCodecs[part]; ok && m.Format == "" {
+				m.Format = codec
+			}
+			if b, ok := musicBitrates[part]; ok && bitrate == "" {
+				bitrate = b
+			}
+			if source, ok := musicSources[part]; ok && m.Source == "" {
+				m.Source = source
+			}
+		}
+	}
+	// Prefer codec over bitrate as the codec is usually implied by the bitrate, e.g. 320 or V0 for MP3
+	if m.Format == "" {
+		m.Format = bitrate
+	}
+	m.Revision = revision(strings.Join(parts[2:yearIndex], "."))
+	return m, nil
+}
+
+func isYear(s string) bool {
+	if len(s) != 4 {
+		return false
+	}
+	year, err := strconv.Atoi(s)
+	return err == nil && year >= 1900 && year <= 2100
+}
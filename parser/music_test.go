@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMusic(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out Media
+	}{
+		{"Artist-Album-2019-GROUP",
+			Media{
+				Release: "Artist-Album-2019-GROUP",
+				Artist:  "Artist",
+				Album:   "Album",
+				Year:    2019,
+				Group:   "GROUP",
+			}},
+		{"Artist_-_Album-(CAT123)-WEB-2020",
+			Media{
+				Release: "Artist_-_Album-(CAT123)-WEB-2020",
+				Artist:  "Artist",
+				Album:   "Album",
+				Year:    2020,
+				Source:  "WEB",
+			}},
+		{"Daft_Punk-Random_Access_Memories-24BIT-WEB-FLAC-2013-GRP",
+			Media{
+				Release: "Daft_Punk-Random_Access_Memories-24BIT-WEB-FLAC-2013-GRP",
+				Artist:  "Daft_Punk",
+				Album:   "Random_Access_Memories",
+				Year:    2013,
+				Format:  "FLAC",
+				Source:  "WEB",
+				Group:   "GRP",
+			}},
+		{"Some_Artist-Some_Album-REPACK-VLS-V0-1999-GRP",
+			Media{
+				Release:  "Some_Artist-Some_Album-REPACK-VLS-V0-1999-GRP",
+				Artist:   "Some_Artist",
+				Album:    "Some_Album",
+				Year:     1999,
+				Format:   "V0",
+				Source:   "VINYL",
+				Revision: 1,
+				Group:    "GRP",
+			}},
+	}
+	for _, tt := range tests {
+		got, err := Music(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("Expected %+v, got %+v", tt.out, got)
+		}
+	}
+}
+
+func TestMusicFail(t *testing.T) {
+	for _, in := range []string{"foo", "Artist-2019-GRP", "Stephen_King-The_Stand-AUDIOBOOK-MP3-2020-GRP"} {
+		if _, err := Music(in); err == nil {
+			t.Errorf("Expected error for %q", in)
+		}
+	}
+}
+
+func TestAudiobook(t *testing.T) {
+	s := "Stephen_King-The_Stand-AUDIOBOOK-WEB-MP3-2020-GRP"
+	got, err := Audiobook(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Media{
+		Release: s,
+		Artist:  "Stephen_King",
+		Album:   "The_Stand",
+		Year:    2020,
+		Format:  "MP3",
+		Source:  "WEB",
+		Group:   "GRP",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
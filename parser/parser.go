@@ -9,17 +9,26 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"unicode/utf8"
 )
 
 var (
-	moviePattern    = regexp.MustCompile(`(.*?)\.(\d{4})`)
 	episodePatterns = [4]*regexp.Regexp{
 		regexp.MustCompile(`^(?P<name>.+?)\.[Ss](?P<season>\d{2})(?:[Ee](?P<episode>\d{2}))?`), // S01, S01E04
 		regexp.MustCompile(`^(?P<name>.+?)\.[Ee](?P<episode>\d{2})`),                           // E04
 		regexp.MustCompile(`^(?P<name>.+?)\.(?P<season>\d{1,2})x(?P<episode>\d{2})`),           // 1x04, 01x04
 		regexp.MustCompile(`^(?P<name>.+?)\.P(?:ar)?t\.?(?P<episode>([^.]+))`),                 // P(ar)t(.)11, Pt(.)XI
 	}
-	splitPattern = regexp.MustCompile(`[-_.]`)
+	splitPattern    = regexp.MustCompile(`[-_.\s()\[\]]`)
+	revisionPattern = regexp.MustCompile(`^(proper|repack|rerip|real)(\d*)$`)
+	groupPattern    = regexp.MustCompile(`-([[:alnum:]]+)$`)
+	wordPattern     = regexp.MustCompile(`[\p{L}\p{N}]+`)
+	yearPattern     = regexp.MustCompile(`^(19|20)\d{2}$`)
+	articles        = map[string]bool{"the": true, "a": true, "an": true}
+	countries       = map[string]bool{
+		"us": true, "uk": true, "au": true, "nz": true, "ca": true, "ie": true, "de": true, "fr": true, "nl": true,
+		"se": true, "no": true, "dk": true, "be": true, "it": true, "es": true, "jp": true, "kr": true,
+	}
 )
 
 type Parser func(s string) (Media, error)
@@ -32,10 +41,19 @@ type Media struct {
 	Episode    int
 	Resolution string
 	Codec      string
+	Revision   int
+	Group      string
+	Artist     string
+	Album      string
+	Format     string
+	Source     string
+	Edition    string
+	Extra      map[string]string
+	Segments   []string
 }
 
 func (m *Media) IsEmpty() bool {
-	return m.Name == ""
+	return m.Name == "" && m.Artist == ""
 }
 
 func (m *Media) ReplaceName(re *regexp.Regexp, repl string) {
@@ -43,15 +61,114 @@ func (m *Media) ReplaceName(re *regexp.Regexp, repl string) {
 }
 
 func (m *Media) Equal(o Media) bool {
+	return m.EqualContent(o) &&
+		m.Resolution == o.Resolution &&
+		m.Codec == o.Codec &&
+		m.Format == o.Format
+}
+
+// EqualContent returns whether m and o are the same media, possibly in different quality. Unlike Equal, this ignores
+// resolution, codec and format.
+func (m *Media) EqualContent(o Media) bool {
 	if m.IsEmpty() {
 		return false
 	}
-	return m.Name == o.Name &&
+	return EqualName(m.Name, o.Name) &&
 		m.Season == o.Season &&
 		m.Episode == o.Episode &&
 		m.Year == o.Year &&
-		m.Resolution == o.Resolution &&
-		m.Codec == o.Codec
+		EqualName(m.Artist, o.Artist) &&
+		EqualName(m.Album, o.Album) &&
+		m.Edition == o.Edition &&
+		equalExtra(m.Extra, o.Extra)
+}
+
+// equalExtra returns whether the extra attributes of two media are equal, e.g. the date captured by a custom parser for
+// daily shows
+func equalExtra(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || !strings.EqualFold(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitName splits name into a normalized key which ignores case, punctuation and a leading article, and a suffix holding a
+// trailing year and/or country code.
+func SplitName(name string) (string, string) {
+	words := wordPattern.FindAllString(strings.ToLower(name), -1)
+	// Keep single letters following the article, as they are likely part of an abbreviation, e.g. A.P.Bio
+	if len(words) > 1 && articles[words[0]] && utf8.RuneCountInString(words[1]) > 1 {
+		words = words[1:]
+	}
+	var suffix []string
+	for i := 0; i < 2 && len(words) > 1; i++ {
+		last := words[len(words)-1]
+		if !yearPattern.MatchString(last) && !countries[last] {
+			break
+		}
+		suffix = append([]string{last}, suffix...)
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, ""), strings.Join(suffix, "")
+}
+
+// NormalizeName returns a key for name which ignores case, punctuation, a leading article and a trailing year or
+// country code. This makes names such as The.Office.(US) and office_us, Doctor.Who.2005 and Doctor.Who, or
+// Marvels.Agents.of.S.H.I.E.L.D and Marvels.Agents.of.SHIELD, equal.
+func NormalizeName(name string) string {
+	key, _ := SplitName(name)
+	return key
+}
+
+// EqualName returns whether names a and b have the same normalized key, and their year or country suffixes do not
+// conflict. A name without a suffix is equal to the same name with any suffix, while e.g. The.Office.US and
+// The.Office.UK are not equal.
+func EqualName(a, b string) bool {
+	keyA, suffixA := SplitName(a)
+	keyB, suffixB := SplitName(b)
+	return keyA == keyB && (suffixA == "" || suffixB == "" || suffixA == suffixB)
+}
+
+func (m *Media) Attribute(name string) (string, error) {
+	switch name {
+	case "Release":
+		return m.Release, nil
+	case "Name":
+		return m.Name, nil
+	case "Year":
+		return strconv.Itoa(m.Year), nil
+	case "Season":
+		return strconv.Itoa(m.Season), nil
+	case "Episode":
+		return strconv.Itoa(m.Episode), nil
+	case "Resolution":
+		return m.Resolution, nil
+	case "Codec":
+		return m.Codec, nil
+	case "Revision":
+		return strconv.Itoa(m.Revision), nil
+	case "Group":
+		return m.Group, nil
+	case "Artist":
+		return m.Artist, nil
+	case "Album":
+		return m.Album, nil
+	case "Format":
+		return m.Format, nil
+	case "Source":
+		return m.Source, nil
+	case "Edition":
+		return m.Edition, nil
+	}
+	if strings.HasPrefix(name, "Extra.") {
+		return m.Extra[strings.TrimPrefix(name, "Extra.")], nil
+	}
+	return "", fmt.Errorf("invalid attribute: %q", name)
 }
 
 func (m *Media) PathIn(dir *template.Template) (string, error) {
@@ -69,26 +186,7 @@ func (m *Media) PathIn(dir *template.Template) (string, error) {
 }
 
 func Default(s string) (Media, error) {
-	return Media{Release: s}, nil
-}
-
-func Movie(s string) (Media, error) {
-	matches := moviePattern.FindStringSubmatch(s)
-	if len(matches) < 3 {
-		return Media{}, fmt.Errorf("invalid input: %q", s)
-	}
-	name := matches[1]
-	year, err := strconv.Atoi(matches[2])
-	if err != nil {
-		return Media{}, fmt.Errorf("invalid input: %q: %s", s, err)
-	}
-	return Media{
-		Release:    s,
-		Name:       name,
-		Year:       year,
-		Resolution: resolution(s),
-		Codec:      codec(s),
-	}, nil
+	return Media{Release: s, Group: group(s)}, nil
 }
 
 func Show(s string) (Media, error) {
@@ -137,6 +235,8 @@ func Show(s string) (Media, error) {
 			Episode:    episode,
 			Resolution: resolution(s),
 			Codec:      codec(s),
+			Revision:   revision(s[len(name):]),
+			Group:      group(s),
 		}, nil
 	}
 	return Media{}, fmt.Errorf("invalid input: %q", s)
@@ -173,6 +273,32 @@ func codec(s string) string {
 	})
 }
 
+func group(s string) string {
+	matches := groupPattern.FindStringSubmatch(s)
+	if len(matches) < 2 {
+		return ""
+	}
+	return matches[1]
+}
+
+func revision(s string) int {
+	// Each tag counts as one revision, e.g. PROPER.REPACK ranks above PROPER. A numeric suffix, as in REPACK2, is the
+	// revision itself
+	n := 0
+	for _, part := range splitPattern.Split(strings.ToLower(s), -1) {
+		matches := revisionPattern.FindStringSubmatch(part)
+		if matches == nil {
+			continue
+		}
+		if rev, err := strconv.Atoi(matches[2]); err == nil {
+			n += rev
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
 var numerals = []numeral{
 	// units
 	{"IX", 9},
@@ -37,6 +37,31 @@ func TestEqual(t *testing.T) {
 			Media{},
 			false,
 		},
+		{
+			Media{Name: "The.Office.US", Season: 1, Episode: 1},
+			Media{Name: "The.Office.(US)", Season: 1, Episode: 1},
+			true,
+		},
+		{
+			Media{Name: "Marvels.Agents.of.SHIELD", Season: 1, Episode: 1},
+			Media{Name: "Marvels.Agents.of.S.H.I.E.L.D", Season: 1, Episode: 1},
+			true,
+		},
+		{
+			Media{Name: "The.Office.US", Season: 1, Episode: 1},
+			Media{Name: "The.Office.UK", Season: 1, Episode: 1},
+			false,
+		},
+		{
+			Media{Artist: "Daft_Punk", Album: "Discovery", Year: 2001, Format: "FLAC", Source: "CD"},
+			Media{Artist: "Daft.Punk", Album: "Discovery", Year: 2001, Format: "FLAC", Source: "WEB"},
+			true,
+		},
+		{
+			Media{Artist: "Daft_Punk", Album: "Discovery", Year: 2001, Format: "FLAC"},
+			Media{Artist: "Daft_Punk", Album: "Discovery", Year: 2001, Format: "MP3"},
+			false,
+		},
 	}
 	for _, tt := range tests {
 		if in := tt.a.Equal(tt.b); in != tt.out {
@@ -45,38 +70,113 @@ func TestEqual(t *testing.T) {
 	}
 }
 
-func TestDefault(t *testing.T) {
-	m, err := Default("foo")
-	if err != nil {
-		t.Fatal(err)
+func TestEqualContent(t *testing.T) {
+	var tests = []struct {
+		a     Media
+		b     Media
+		equal bool
+		same  bool
+	}{
+		{
+			Media{Name: "The.Wire", Season: 1, Episode: 1, Resolution: "720p", Codec: "x264"},
+			Media{Name: "The.Wire", Season: 1, Episode: 1, Resolution: "1080p", Codec: "x265"},
+			false,
+			true,
+		},
+		{
+			Media{Artist: "Daft_Punk", Album: "Discovery", Year: 2001, Format: "FLAC"},
+			Media{Artist: "Daft_Punk", Album: "Discovery", Year: 2001, Format: "MP3"},
+			false,
+			true,
+		},
+		{
+			Media{Name: "The.Wire", Season: 1, Episode: 1, Resolution: "720p"},
+			Media{Name: "The.Wire", Season: 1, Episode: 2, Resolution: "720p"},
+			false,
+			false,
+		},
+		{
+			Media{Name: "The.Daily.Show", Year: 2019, Extra: map[string]string{"month": "03", "day": "15"}},
+			Media{Name: "The.Daily.Show", Year: 2019, Extra: map[string]string{"month": "03", "day": "14"}},
+			false,
+			false,
+		},
+		{
+			Media{Name: "The.Daily.Show", Year: 2019, Extra: map[string]string{"month": "03", "day": "15"}},
+			Media{Name: "The.Daily.Show", Year: 2019, Extra: map[string]string{"month": "03", "day": "15"}, Resolution: "720p"},
+			false,
+			true,
+		},
+		{
+			Media{Name: "Apocalypse.Now", Year: 1979, Edition: "Redux"},
+			Media{Name: "Apocalypse.Now", Year: 1979},
+			false,
+			false,
+		},
 	}
-	if got, want := m.Release, "foo"; got != want {
-		t.Errorf("want %q, got %q", want, got)
+	for _, tt := range tests {
+		if got := tt.a.Equal(tt.b); got != tt.equal {
+			t.Errorf("Equal(%+v, %+v) = %t, want %t", tt.a, tt.b, got, tt.equal)
+		}
+		if got := tt.a.EqualContent(tt.b); got != tt.same {
+			t.Errorf("EqualContent(%+v, %+v) = %t, want %t", tt.a, tt.b, got, tt.same)
+		}
 	}
 }
 
-func TestMovie(t *testing.T) {
-	s := "Apocalypse.Now.1979.1080p.x264.BluRay-GRP"
-	movie, err := Movie(s)
-	if err != nil {
-		t.Fatal(err)
+func TestNormalizeName(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{"The.Office.US", "office"},
+		{"the_office_(us)", "office"},
+		{"Doctor.Who.(2005)", "doctorwho"},
+		{"Doctor.Who.2005", "doctorwho"},
+		{"The.Office.US.2005", "office"},
+		{"A.P.Bio", "apbio"},
+		{"AP.Bio", "apbio"},
+		{"Fear.the.Walking.Dead", "fearthewalkingdead"},
+		{"The", "the"},
+		{"2012", "2012"},
+		{"\u0428\u0435\u0440\u043b\u043e\u043a", "\u0448\u0435\u0440\u043b\u043e\u043a"},
+		{"\u30ab\u30a6\u30dc\u30fc\u30a4.\u30d3\u30d0\u30c3\u30d7", "\u30ab\u30a6\u30dc\u30fc\u30a4\u30d3\u30d0\u30c3\u30d7"},
+		{"Am\u00e9lie", "am\u00e9lie"},
 	}
-	expected := Media{
-		Release:    s,
-		Name:       "Apocalypse.Now",
-		Year:       1979,
-		Resolution: "1080p",
-		Codec:      "x264",
+	for _, tt := range tests {
+		if got := NormalizeName(tt.in); got != tt.out {
+			t.Errorf("NormalizeName(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestEqualName(t *testing.T) {
+	var tests = []struct {
+		a, b  string
+		equal bool
+	}{
+		{"The.Office.US", "The.Office.(US)", true},
+		{"The.Office.US", "The.Office", true},
+		{"The.Office.US", "The.Office.UK", false},
+		{"Doctor.Who.2005", "Doctor.Who", true},
+		{"Doctor.Who.2005", "Doctor.Who.1963", false},
+		{"\u0428\u0435\u0440\u043b\u043e\u043a", "\u0414\u043e\u043a\u0442\u043e\u0440.\u041a\u0442\u043e", false},
+		{"\u0428\u0435\u0440\u043b\u043e\u043a", "\u0448\u0435\u0440\u043b\u043e\u043a", true},
 	}
-	if !reflect.DeepEqual(movie, expected) {
-		t.Fatalf("Expected %+v, got %+v", expected, movie)
+	for _, tt := range tests {
+		if got := EqualName(tt.a, tt.b); got != tt.equal {
+			t.Errorf("EqualName(%q, %q) = %t, want %t", tt.a, tt.b, got, tt.equal)
+		}
 	}
 }
 
-func TestMovieFail(t *testing.T) {
-	_, err := Movie("foo")
-	if err == nil {
-		t.Fatal("Expected error")
+func TestDefault(t *testing.T) {
+	m, err := Default("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Release, "foo"; got != want {
+		t.Errorf("want %q, got %q", want, got)
 	}
 }
 
@@ -88,6 +188,7 @@ func TestShow(t *testing.T) {
 		{"Gotham.S01E01.720p.HDTV.X264-DIMENSION",
 			Media{
 				Release:    "Gotham.S01E01.720p.HDTV.X264-DIMENSION",
+				Group:      "DIMENSION",
 				Name:       "Gotham",
 				Season:     1,
 				Episode:    1,
@@ -97,6 +198,7 @@ func TestShow(t *testing.T) {
 		{"gotham.s01e01.720p.hdtv.x264-dimension",
 			Media{
 				Release:    "gotham.s01e01.720p.hdtv.x264-dimension",
+				Group:      "dimension",
 				Name:       "Gotham",
 				Season:     1,
 				Episode:    1,
@@ -106,6 +208,7 @@ func TestShow(t *testing.T) {
 		{"Top_Gear.21x02.720p_HDTV_x264-FoV",
 			Media{
 				Release:    "Top_Gear.21x02.720p_HDTV_x264-FoV",
+				Group:      "FoV",
 				Name:       "Top_Gear",
 				Season:     21,
 				Episode:    2,
@@ -115,6 +218,7 @@ func TestShow(t *testing.T) {
 		{"Eastbound.and.Down.S02E05.720p.BluRay.X264-REWARD",
 			Media{
 				Release:    "Eastbound.and.Down.S02E05.720p.BluRay.X264-REWARD",
+				Group:      "REWARD",
 				Name:       "Eastbound.and.Down",
 				Season:     2,
 				Episode:    5,
@@ -124,6 +228,7 @@ func TestShow(t *testing.T) {
 		{"Olive.Kitteridge.Part.4.720p.HDTV.x264-KILLERS",
 			Media{
 				Release:    "Olive.Kitteridge.Part.4.720p.HDTV.x264-KILLERS",
+				Group:      "KILLERS",
 				Name:       "Olive.Kitteridge",
 				Season:     1,
 				Episode:    4,
@@ -133,6 +238,7 @@ func TestShow(t *testing.T) {
 		{"Marilyn.The.Secret.Life.of.Marilyn.Monroe.2015.Part1.720p.HDTV.x264-W4F",
 			Media{
 				Release:    "Marilyn.The.Secret.Life.of.Marilyn.Monroe.2015.Part1.720p.HDTV.x264-W4F",
+				Group:      "W4F",
 				Name:       "Marilyn.The.Secret.Life.of.Marilyn.Monroe.2015",
 				Season:     1,
 				Episode:    1,
@@ -142,6 +248,7 @@ func TestShow(t *testing.T) {
 		{"The.Jinx-The.Life.and.Deaths.of.Robert.Durst.E04.1080p.BluRay.x264-ROVERS",
 			Media{
 				Release:    "The.Jinx-The.Life.and.Deaths.of.Robert.Durst.E04.1080p.BluRay.x264-ROVERS",
+				Group:      "ROVERS",
 				Name:       "The.Jinx-The.Life.and.Deaths.of.Robert.Durst",
 				Season:     1,
 				Episode:    4,
@@ -151,6 +258,7 @@ func TestShow(t *testing.T) {
 		{"Adventure.Time.With.Finn.And.Jake.S01.SUBPACK.720p.BluRay.x264-DEiMOS",
 			Media{
 				Release:    "Adventure.Time.With.Finn.And.Jake.S01.SUBPACK.720p.BluRay.x264-DEiMOS",
+				Group:      "DEiMOS",
 				Name:       "Adventure.Time.With.Finn.And.Jake",
 				Season:     1,
 				Episode:    0,
@@ -160,6 +268,7 @@ func TestShow(t *testing.T) {
 		{"Orange.Is.The.New.Black.S02.NORDiC.SUBPACK.BluRay-REQ",
 			Media{
 				Release: "Orange.Is.The.New.Black.S02.NORDiC.SUBPACK.BluRay-REQ",
+				Group:   "REQ",
 				Name:    "Orange.Is.The.New.Black",
 				Season:  2,
 				Episode: 0,
@@ -167,6 +276,7 @@ func TestShow(t *testing.T) {
 		{"Lost.S01E24.Exodus.Part.2.720p.BluRay.x264-SiNNERS",
 			Media{
 				Release:    "Lost.S01E24.Exodus.Part.2.720p.BluRay.x264-SiNNERS",
+				Group:      "SiNNERS",
 				Name:       "Lost",
 				Season:     1,
 				Episode:    24,
@@ -176,6 +286,7 @@ func TestShow(t *testing.T) {
 		{"Friends.S01E16.S01E17.UNCUT.DVDrip.XviD-SAiNTS",
 			Media{
 				Release: "Friends.S01E16.S01E17.UNCUT.DVDrip.XviD-SAiNTS",
+				Group:   "SAiNTS",
 				Name:    "Friends",
 				Season:  1,
 				Episode: 16,
@@ -184,6 +295,7 @@ func TestShow(t *testing.T) {
 		{"Generation.Kill.Pt.VII.Bomb.in.the.Garden.720p.Bluray.X264-DIMENSION",
 			Media{
 				Release:    "Generation.Kill.Pt.VII.Bomb.in.the.Garden.720p.Bluray.X264-DIMENSION",
+				Group:      "DIMENSION",
 				Name:       "Generation.Kill",
 				Season:     1,
 				Episode:    7,
@@ -210,6 +322,72 @@ func TestShowFail(t *testing.T) {
 	}
 }
 
+func TestGroup(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{"The.Wire.S01E01.720p.HDTV.x264-GRP", "GRP"},
+		{"The.Wire.S01E01.720p.HDTV.x264", ""},
+		{"The.Jinx-The.Life.and.Deaths.of.Robert.Durst.E04", ""},
+		{"The.Wire.S01E01-", ""},
+	}
+	for _, tt := range tests {
+		if got := group(tt.in); got != tt.out {
+			t.Errorf("Expected %q for %q, got %q", tt.out, tt.in, got)
+		}
+	}
+}
+
+func TestRevision(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out int
+	}{
+		{"The.Wire.S01E01.720p.HDTV.x264-GRP", 0},
+		{"The.Wire.S01E01.PROPER.720p.HDTV.x264-GRP", 1},
+		{"The.Wire.S01E01.REPACK.720p.HDTV.x264-GRP", 1},
+		{"The.Wire.S01E01.REAL.PROPER.720p.HDTV.x264-GRP", 2},
+		{"The.Wire.S01E01.REPACK2.720p.HDTV.x264-GRP", 2},
+		{"The.Real.World.S01E01.720p.HDTV.x264-GRP", 0},
+	}
+	for _, tt := range tests {
+		m, err := Show(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Revision != tt.out {
+			t.Errorf("Expected Revision=%d for %q, got %d", tt.out, tt.in, m.Revision)
+		}
+	}
+}
+
+func TestAttribute(t *testing.T) {
+	m := Media{Name: "The.Wire", Season: 1, Resolution: "720p", Group: "GRP"}
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{"Name", "The.Wire"},
+		{"Season", "1"},
+		{"Episode", "0"},
+		{"Resolution", "720p"},
+		{"Group", "GRP"},
+	}
+	for _, tt := range tests {
+		got, err := m.Attribute(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.out {
+			t.Errorf("Expected %q for %s, got %q", tt.out, tt.in, got)
+		}
+	}
+	if _, err := m.Attribute("foo"); err == nil {
+		t.Error("Expected error")
+	}
+}
+
 func TestReplaceName(t *testing.T) {
 	m := Media{Name: "Youre.The.Worst"}
 	re := regexp.MustCompile(`\.The\.`)
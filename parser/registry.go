@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var defaultRegistry = &Registry{parsers: map[string]Parser{
+	"":          Default,
+	"show":      Show,
+	"movie":     Movie,
+	"music":     Music,
+	"audiobook": Audiobook,
+}}
+
+type Registry struct {
+	mu      sync.RWMutex
+	parsers map[string]Parser
+}
+
+// Register adds parser p to the default registry. Parsers in the default registry are included in every registry
+// created by NewRegistry.
+func Register(name string, p Parser) error { return defaultRegistry.Register(name, p) }
+
+func NewRegistry() *Registry {
+	defaultRegistry.mu.RLock()
+	defer defaultRegistry.mu.RUnlock()
+	r := Registry{parsers: make(map[string]Parser, len(defaultRegistry.parsers))}
+	for name, p := range defaultRegistry.parsers {
+		r.parsers[name] = p
+	}
+	return &r
+}
+
+func (r *Registry) Register(name string, p Parser) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.parsers[name]; ok {
+		return fmt.Errorf("parser already registered: %q", name)
+	}
+	r.parsers[name] = p
+	return nil
+}
+
+func (r *Registry) Lookup(name string) (Parser, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.parsers[name]
+	return p, ok
+}
+
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.parsers))
+	for name := range r.parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Regexp returns a parser which parses media using the first matching pattern. Patterns can contain the named groups
+// name, season, episode, year, resolution, codec and group, which set the corresponding field in Media. Any other
+// named group is stored in Media.Extra.
+func Regexp(patterns ...*regexp.Regexp) Parser {
+	return func(s string) (Media, error) {
+		for _, p := range patterns {
+			matches := p.FindStringSubmatch(s)
+			if len(matches) == 0 {
+				continue
+			}
+			m := Media{
+				Release:    s,
+				Resolution: resolution(s),
+				Codec:      codec(s),
+				Group:      group(s),
+			}
+			var err error
+			for i, name := range p.SubexpNames() {
+				value := matches[i]
+				if name == "" || value == "" {
+					continue
+				}
+				switch name {
+				case "name":
+					m.Name = value
+				case "season":
+					m.Season, err = strconv.Atoi(value)
+				case "episode":
+					m.Episode, err = strconv.Atoi(value)
+					if err != nil {
+						m.Episode, err = rtoi(value)
+					}
+				case "year":
+					m.Year, err = strconv.Atoi(value)
+				case "resolution":
+					m.Resolution = value
+				case "codec":
+					m.Codec = value
+				case "group":
+					m.Group = value
+				default:
+					if m.Extra == nil {
+						m.Extra = make(map[string]string)
+					}
+					m.Extra[name] = value
+				}
+				if err != nil {
+					return Media{}, fmt.Errorf("invalid input: %q: %w", s, err)
+				}
+			}
+			m.Revision = revision(strings.Replace(s, m.Name, "", 1))
+			return m, nil
+		}
+		return Media{}, fmt.Errorf("invalid input: %q", s)
+	}
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	if want := []string{"", "audiobook", "movie", "music", "show"}; !reflect.DeepEqual(r.Names(), want) {
+		t.Errorf("Expected %q, got %q", want, r.Names())
+	}
+	if err := r.Register("show", Default); err == nil {
+		t.Error("Expected error when registering existing parser")
+	}
+	if err := r.Register("foo", Default); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.Lookup("foo"); !ok {
+		t.Error("Expected parser to be registered")
+	}
+	// Parsers added to a registry are not shared
+	if _, ok := NewRegistry().Lookup("foo"); ok {
+		t.Error("Expected parser to only exist in its registry")
+	}
+}
+
+func TestRegexp(t *testing.T) {
+	p := Regexp(
+		regexp.MustCompile(`^(?P<name>.+?)\.(?P<year>\d{4})\.(?P<month>\d{2})\.(?P<day>\d{2})\.`),
+		regexp.MustCompile(`^(?P<name>.+?)\.Episode\.(?P<episode>\d+)`),
+	)
+	var tests = []struct {
+		in  string
+		out Media
+	}{
+		{"The.Daily.Show.2019.03.14.720p.WEB.x264-GRP",
+			Media{
+				Release:    "The.Daily.Show.2019.03.14.720p.WEB.x264-GRP",
+				Name:       "The.Daily.Show",
+				Year:       2019,
+				Resolution: "720p",
+				Codec:      "x264",
+				Group:      "GRP",
+				Extra:      map[string]string{"month": "03", "day": "14"},
+			}},
+		{"Planet.Earth.Episode.4.PROPER.1080p-GRP",
+			Media{
+				Release:    "Planet.Earth.Episode.4.PROPER.1080p-GRP",
+				Name:       "Planet.Earth",
+				Episode:    4,
+				Resolution: "1080p",
+				Revision:   1,
+				Group:      "GRP",
+			}},
+	}
+	for _, tt := range tests {
+		got, err := p(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("Expected %+v, got %+v", tt.out, got)
+		}
+	}
+	if _, err := p("foo"); err == nil {
+		t.Error("Expected error")
+	}
+}
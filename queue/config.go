@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
@@ -17,48 +18,122 @@ import (
 	"github.com/mpolden/lftpq/parser"
 )
 
+var settingPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*:[a-z0-9-]+(/\S+)?$`)
+
+const (
+	execPrefix           = "exec:"
+	defaultParserTimeout = 10 * time.Second
+)
+
 type Config struct {
 	Default   Site
+	Parsers   []Parser
 	LocalDirs []LocalDir
 	Sites     []Site
 }
 
+type Parser struct {
+	Name     string
+	Patterns []string
+}
+
 type Replacement struct {
 	Pattern     string
 	pattern     *regexp.Regexp
 	Replacement string
 }
 
+type Rule struct {
+	Field   string
+	Pattern string
+	pattern *regexp.Regexp
+}
+
+type Score struct {
+	Rule
+	Score int
+}
+
+type GetCmdOverride struct {
+	Rule
+	Command string
+}
+
+type alias struct {
+	from string
+	to   string
+}
+
 type LocalDir struct {
-	Name         string
-	Parser       string
-	Dir          string
-	Replacements []Replacement
-	Template     *template.Template `json:"-"`
-	parser       parser.Parser
+	Name           string
+	Parser         string
+	Dir            string
+	Replacements   []Replacement
+	Aliases        map[string]string
+	aliases        []alias
+	ParserTimeout  string
+	Sanitize       Sanitize
+	MinFreeSpace   string
+	minFreeSpace   int64
+	ExtractCommand string
+	extract        extractFunc
+	Template       *template.Template `json:"-"`
+	root           string
+	parser         parser.Parser
+	freeSpace      func(path string) (int64, error)
+	batch          func(names []string) error
+	close          func() error
 }
 
 type Site struct {
-	GetCmd       string
-	Name         string
-	Dirs         []string
-	MaxAge       string
-	maxAge       time.Duration
-	Patterns     []string
-	patterns     []*regexp.Regexp
-	Filters      []string
-	filters      []*regexp.Regexp
-	SkipSymlinks bool
-	SkipExisting bool
-	SkipFiles    bool
-	LocalDir     string
-	localDir     LocalDir
-	Priorities   []string
-	priorities   []*regexp.Regexp
-	PostCommand  string
-	postCommand  *exec.Cmd
-	Merge        bool
-	Skip         bool
+	GetCmd           string
+	GetDirCmd        string
+	GetFileCmd       string
+	GetCmdOverrides  []GetCmdOverride
+	Name             string
+	Dirs             []string
+	DaysBack         int
+	MaxDepth         int
+	DirSizes         bool
+	MaxAge           string
+	maxAge           time.Duration
+	MinSize          string
+	minSize          int64
+	MaxSize          string
+	maxSize          int64
+	Patterns         []string
+	patterns         []*regexp.Regexp
+	Filters          []string
+	filters          []*regexp.Regexp
+	SkipSymlinks     bool
+	SkipExisting     bool
+	SkipFiles        bool
+	LocalDir         string
+	localDir         LocalDir
+	Priorities       []string
+	priorities       []*regexp.Regexp
+	PreferredGroups  []string
+	BlockedGroups    []string
+	Scores           []Score
+	Cutoff           Rule
+	RateLimit        string
+	rateLimit        int64
+	TransferWindows  []TransferWindow
+	CheckIncomplete  bool
+	IncompleteTags   []string
+	incompleteTags   []*regexp.Regexp
+	MinQuietAge      string
+	minQuietAge      time.Duration
+	LftpSettings     map[string]string
+	Preamble         []string
+	Epilogue         []string
+	VerifyChecksums  bool
+	RequeueFailed    bool
+	PostCommand      string
+	postCommand      *exec.Cmd
+	Merge            bool
+	DeleteSuperseded bool
+	Skip             bool
 }
 
 func (d *LocalDir) Media(name string) (parser.Media, error) {
@@ -69,9 +144,101 @@ func (d *LocalDir) Media(name string) (parser.Media, error) {
 	for _, r := range d.Replacements {
 		m.ReplaceName(r.pattern, r.Replacement)
 	}
+	if name, ok := d.alias(m.Name); ok {
+		m.Name = name
+	}
 	return m, nil
 }
 
+// alias returns the canonical name for name. The name must be equal to the alias, so that e.g. an alias for
+// The.Office.US is not used for The.Office.UK. A name with a year or country suffix must also agree with the canonical
+// name, so that an alias from Doctor.Who to Doctor.Who.(2005) is not used for Doctor.Who.1963.
+func (d *LocalDir) alias(name string) (string, bool) {
+	for _, a := range d.aliases {
+		if !parser.EqualName(name, a.from) {
+			continue
+		}
+		if _, suffix := parser.SplitName(name); suffix == "" || parser.EqualName(name, a.to) {
+			return a.to, true
+		}
+	}
+	return "", false
+}
+
+func (r Rule) String() string {
+	if r.Field == "" {
+		return r.Pattern
+	}
+	return r.Field + ":" + r.Pattern
+}
+
+func (r *Rule) match(item *Item) bool {
+	if r.Field == "" {
+		return r.pattern.MatchString(filepath.Base(item.RemotePath))
+	}
+	value, err := item.Media.Attribute(r.Field)
+	if err != nil {
+		return false
+	}
+	return r.pattern.MatchString(value)
+}
+
+func compileRule(rule Rule) (Rule, error) {
+	if rule.Field != "" {
+		if _, err := (&parser.Media{}).Attribute(rule.Field); err != nil {
+			return Rule{}, err
+		}
+	}
+	pattern, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return Rule{}, err
+	}
+	rule.pattern = pattern
+	return rule, nil
+}
+
+func compileScores(scores []Score) ([]Score, error) {
+	res := make([]Score, 0, len(scores))
+	for _, s := range scores {
+		rule, err := compileRule(s.Rule)
+		if err != nil {
+			return nil, err
+		}
+		s.Rule = rule
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// Prefetch parses names in a single batch, if supported by the parser of this local dir. Subsequent calls to Media
+// for the same names use the batched result.
+func (d *LocalDir) Prefetch(names []string) error {
+	if d.batch == nil {
+		return nil
+	}
+	bases := make([]string, len(names))
+	for i, name := range names {
+		bases[i] = filepath.Base(name)
+	}
+	return d.batch(bases)
+}
+
+func compileOverrides(overrides []GetCmdOverride) ([]GetCmdOverride, error) {
+	res := make([]GetCmdOverride, 0, len(overrides))
+	for _, o := range overrides {
+		if o.Command == "" {
+			return nil, fmt.Errorf("invalid command for %q: %q", o.Rule, o.Command)
+		}
+		rule, err := compileRule(o.Rule)
+		if err != nil {
+			return nil, err
+		}
+		o.Rule = rule
+		res = append(res, o)
+	}
+	return res, nil
+}
+
 func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
 	res := make([]*regexp.Regexp, 0, len(patterns))
 	for _, p := range patterns {
@@ -97,13 +264,39 @@ func compileReplacements(replacements []Replacement) ([]Replacement, error) {
 	return res, nil
 }
 
-func parseTemplate(tmpl string) (*template.Template, error) {
-	funcMap := template.FuncMap{"Sprintf": fmt.Sprintf}
-	t, err := template.New("").Funcs(funcMap).Parse(tmpl)
-	if err != nil {
-		return nil, err
+func compileAliases(aliases map[string]string) []alias {
+	res := make([]alias, 0, 2*len(aliases))
+	for from, to := range aliases {
+		res = append(res, alias{from: from, to: to}, alias{from: to, to: to})
 	}
-	return t, nil
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].from == res[j].from {
+			return res[i].to < res[j].to
+		}
+		return res[i].from < res[j].from
+	})
+	return res
+}
+
+func validateSettings(settings map[string]string) error {
+	for k, v := range settings {
+		if !settingPattern.MatchString(k) {
+			return fmt.Errorf("invalid lftp setting: %q", k)
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("invalid value for lftp setting %q: %q", k, v)
+		}
+	}
+	return nil
+}
+
+func validateScript(lines []string) error {
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" || strings.ContainsAny(line, "\r\n") {
+			return fmt.Errorf("invalid lftp command: %q", line)
+		}
+	}
+	return nil
 }
 
 func expandUser(path string) string {
@@ -134,7 +327,39 @@ func command(cmd string) (*exec.Cmd, error) {
 	return exec.Command(program, argv[1:]...), nil
 }
 
+func parserCommand(cmd, timeout string) (*parser.Command, error) {
+	d := defaultParserTimeout
+	if timeout != "" {
+		var err error
+		if d, err = time.ParseDuration(timeout); err != nil {
+			return nil, err
+		}
+	}
+	argv := strings.Split(cmd, " ")
+	program := expandUser(argv[0])
+	if _, err := exec.LookPath(program); err != nil {
+		return nil, err
+	}
+	return parser.NewCommand(program, argv[1:], d), nil
+}
+
 func (c *Config) load() error {
+	parsers := parser.NewRegistry()
+	for _, p := range c.Parsers {
+		if p.Name == "" {
+			return fmt.Errorf("invalid parser name: %q", p.Name)
+		}
+		patterns, err := compilePatterns(p.Patterns)
+		if err != nil {
+			return fmt.Errorf("invalid parser %q: %w", p.Name, err)
+		}
+		if len(patterns) == 0 {
+			return fmt.Errorf("invalid parser %q: no patterns", p.Name)
+		}
+		if err := parsers.Register(p.Name, parser.Regexp(patterns...)); err != nil {
+			return err
+		}
+	}
 	localDirs := make(map[string]LocalDir)
 	for i, d := range c.LocalDirs {
 		if d.Name == "" {
@@ -146,29 +371,63 @@ func (c *Config) load() error {
 		if _, ok := localDirs[d.Name]; ok {
 			return fmt.Errorf("invalid local dir: %q: declared multiple times", d.Name)
 		}
-		var parserFunc parser.Parser
-		switch d.Parser {
-		case "show":
-			parserFunc = parser.Show
-		case "movie":
-			parserFunc = parser.Movie
-		case "":
-			parserFunc = parser.Default
-		default:
-			return fmt.Errorf("invalid local dir %q: invalid parser: %q (must be %q, %q or %q)",
-				d.Name, d.Parser, "show", "movie", "")
+		var (
+			parserFunc parser.Parser
+			batch      func([]string) error
+			close      func() error
+		)
+		if strings.HasPrefix(d.Parser, execPrefix) {
+			cmd, err := parserCommand(strings.TrimPrefix(d.Parser, execPrefix), d.ParserTimeout)
+			if err != nil {
+				return fmt.Errorf("invalid local dir %q: %w", d.Name, err)
+			}
+			parserFunc = cmd.Parse
+			batch = cmd.ParseAll
+			close = cmd.Close
+		} else {
+			var ok bool
+			parserFunc, ok = parsers.Lookup(d.Parser)
+			if !ok {
+				return fmt.Errorf("invalid local dir %q: invalid parser: %q (must be one of %q or %s<path>)",
+					d.Name, d.Parser, parsers.Names(), execPrefix)
+			}
 		}
 		tmpl, err := parseTemplate(d.Dir)
 		if err != nil {
 			return err
 		}
+		if err := validateTemplate(tmpl); err != nil {
+			return fmt.Errorf("invalid local dir %q: %w", d.Name, err)
+		}
 		replacements, err := compileReplacements(d.Replacements)
 		if err != nil {
 			return err
 		}
 		c.LocalDirs[i].parser = parserFunc
+		c.LocalDirs[i].batch = batch
+		c.LocalDirs[i].close = close
 		c.LocalDirs[i].Replacements = replacements
+		c.LocalDirs[i].aliases = compileAliases(d.Aliases)
+		if err := c.LocalDirs[i].Sanitize.compile(); err != nil {
+			return fmt.Errorf("invalid local dir %q: %w", d.Name, err)
+		}
+		if d.MinFreeSpace != "" {
+			minFreeSpace, err := parseSize(d.MinFreeSpace)
+			if err != nil {
+				return fmt.Errorf("invalid local dir %q: %w", d.Name, err)
+			}
+			c.LocalDirs[i].minFreeSpace = minFreeSpace
+		}
+		c.LocalDirs[i].freeSpace = diskFree
+		cmd, err := command(d.ExtractCommand)
+		if err != nil {
+			return fmt.Errorf("invalid local dir %q: invalid extract command: %w", d.Name, err)
+		}
+		if cmd != nil {
+			c.LocalDirs[i].extract = extractCommand(cmd.Path, cmd.Args[1:])
+		}
 		c.LocalDirs[i].Template = tmpl
+		c.LocalDirs[i].root = templateRoot(d.Dir)
 		localDirs[d.Name] = c.LocalDirs[i]
 	}
 	for i := range c.Sites {
@@ -178,6 +437,58 @@ func (c *Config) load() error {
 			return err
 		}
 		site.maxAge = maxAge
+		if site.MinSize != "" {
+			if site.minSize, err = parseSize(site.MinSize); err != nil {
+				return fmt.Errorf("site: %q: %w", site.Name, err)
+			}
+		}
+		if site.MaxSize != "" {
+			if site.maxSize, err = parseSize(site.MaxSize); err != nil {
+				return fmt.Errorf("site: %q: %w", site.Name, err)
+			}
+		}
+		if site.RateLimit != "" {
+			if site.rateLimit, err = parseSize(site.RateLimit); err != nil {
+				return fmt.Errorf("site: %q: invalid rate limit: %w", site.Name, err)
+			}
+		}
+		windows, err := compileWindows(site.TransferWindows)
+		if err != nil {
+			return fmt.Errorf("site: %q: invalid transfer window: %w", site.Name, err)
+		}
+		site.TransferWindows = windows
+		if site.incompleteTags, err = compilePatterns(site.IncompleteTags); err != nil {
+			return fmt.Errorf("site: %q: invalid incomplete tag: %w", site.Name, err)
+		}
+		if site.MinQuietAge != "" {
+			if site.minQuietAge, err = time.ParseDuration(site.MinQuietAge); err != nil {
+				return fmt.Errorf("site: %q: invalid min quiet age: %w", site.Name, err)
+			}
+		}
+		if err := validateSettings(site.LftpSettings); err != nil {
+			return fmt.Errorf("site: %q: %w", site.Name, err)
+		}
+		if err := validateScript(site.Preamble); err != nil {
+			return fmt.Errorf("site: %q: invalid preamble: %w", site.Name, err)
+		}
+		if err := validateScript(site.Epilogue); err != nil {
+			return fmt.Errorf("site: %q: invalid epilogue: %w", site.Name, err)
+		}
+		if site.DaysBack < 0 {
+			return fmt.Errorf("site: %q: invalid days back: %d", site.Name, site.DaysBack)
+		}
+		dirs, err := site.RemoteDirs(time.Now())
+		if err != nil {
+			return fmt.Errorf("site: %q: invalid dir: %w", site.Name, err)
+		}
+		for _, dir := range dirs {
+			if err := validateDir(dir); err != nil {
+				return fmt.Errorf("site: %q: %w", site.Name, err)
+			}
+		}
+		if site.MaxDepth < 0 {
+			return fmt.Errorf("site: %q: invalid max depth: %d", site.Name, site.MaxDepth)
+		}
 		patterns, err := compilePatterns(site.Patterns)
 		if err != nil {
 			return err
@@ -193,6 +504,23 @@ func (c *Config) load() error {
 			return err
 		}
 		site.priorities = priorities
+		scores, err := compileScores(site.Scores)
+		if err != nil {
+			return err
+		}
+		site.Scores = scores
+		overrides, err := compileOverrides(site.GetCmdOverrides)
+		if err != nil {
+			return fmt.Errorf("site: %q: %w", site.Name, err)
+		}
+		site.GetCmdOverrides = overrides
+		if site.Cutoff.Pattern != "" {
+			cutoff, err := compileRule(site.Cutoff)
+			if err != nil {
+				return err
+			}
+			site.Cutoff = cutoff
+		}
 
 		cmd, err := command(site.PostCommand)
 		if err != nil {
@@ -223,6 +551,20 @@ func (c *Config) SetLocalDir(name string) error {
 	return nil
 }
 
+// Close stops any external parser programs started by local dirs.
+func (c *Config) Close() error {
+	var err error
+	for _, d := range c.LocalDirs {
+		if d.close == nil {
+			continue
+		}
+		if cerr := d.close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
 func (c *Config) JSON() ([]byte, error) {
 	return json.MarshalIndent(c, "", "  ")
 }
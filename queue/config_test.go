@@ -66,6 +66,81 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+func TestLoadParsers(t *testing.T) {
+	cfg := Config{
+		Parsers: []Parser{{
+			Name:     "daily",
+			Patterns: []string{`^(?P<name>.+?)\.(?P<year>\d{4})\.(?P<month>\d{2})\.(?P<day>\d{2})`},
+		}},
+		LocalDirs: []LocalDir{{Name: "d1", Parser: "daily", Dir: "/tmp/{{ .Name }}/{{ .Year }}-{{ .Extra.month }}/"}},
+	}
+	if err := cfg.load(); err != nil {
+		t.Fatal(err)
+	}
+	item, err := newItem("/remote/The.Daily.Show.2019.03.14.720p", nil, time.Time{}, cfg.LocalDirs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/tmp/The.Daily.Show/2019-03/The.Daily.Show.2019.03.14.720p"; item.LocalPath != want {
+		t.Errorf("Expected %q, got %q", want, item.LocalPath)
+	}
+
+	cfg.LocalDirs[0].Parser = "weekly"
+	if err := cfg.load(); err == nil {
+		t.Error("Expected error for unknown parser")
+	}
+	cfg.LocalDirs[0].Parser = "daily"
+	cfg.Parsers = append(cfg.Parsers, Parser{Name: "show", Patterns: []string{"foo"}})
+	if err := cfg.load(); err == nil {
+		t.Error("Expected error for duplicate parser")
+	}
+}
+
+func TestLoadScores(t *testing.T) {
+	cfg := Config{
+		LocalDirs: []LocalDir{{Name: "d1", Dir: "/tmp/"}},
+		Sites: []Site{{
+			Name:     "foo",
+			MaxAge:   "0",
+			LocalDir: "d1",
+			Scores:   []Score{{Rule: Rule{Field: "Resolution", Pattern: "^1080p$"}, Score: 10}},
+		}},
+	}
+	if err := cfg.load(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Sites[0].Scores[0].pattern == nil {
+		t.Error("Expected pattern to be compiled")
+	}
+	cfg.Sites[0].Scores[0].Field = "Foo"
+	if err := cfg.load(); err == nil {
+		t.Error("Expected error for invalid field")
+	}
+}
+
+func TestLoadScript(t *testing.T) {
+	var tests = []struct {
+		site  Site
+		valid bool
+	}{
+		{Site{LftpSettings: map[string]string{"ftp:passive-mode": "on", "ftp:ssl-allow/example.com": "no"}, Preamble: []string{"debug 3"}}, true},
+		{Site{LftpSettings: map[string]string{"passive-mode": "on"}}, false},
+		{Site{LftpSettings: map[string]string{"ftp:passive mode": "on"}}, false},
+		{Site{LftpSettings: map[string]string{"ftp:passive-mode": "on\nexit"}}, false},
+		{Site{Preamble: []string{""}}, false},
+		{Site{Epilogue: []string{"echo foo\nexit"}}, false},
+	}
+	for _, tt := range tests {
+		tt.site.Name = "foo"
+		tt.site.MaxAge = "0"
+		cfg := Config{LocalDirs: []LocalDir{{Name: "d1", Dir: "/tmp/"}}, Sites: []Site{tt.site}}
+		cfg.Sites[0].LocalDir = "d1"
+		if err := cfg.load(); (err == nil) != tt.valid {
+			t.Errorf("load(%+v) = %v, want valid=%t", tt.site, err, tt.valid)
+		}
+	}
+}
+
 func TestReadConfig(t *testing.T) {
 	jsonConfig := `
 {
@@ -198,3 +273,50 @@ func TestExpandUser(t *testing.T) {
 		}
 	}
 }
+
+func TestClose(t *testing.T) {
+	cfg := Config{
+		LocalDirs: []LocalDir{
+			{Name: "d1", Parser: "show", Dir: "/tmp/"},
+			{Name: "d2", Parser: "exec:cat", Dir: "/tmp/"},
+		},
+	}
+	if err := cfg.load(); err != nil {
+		t.Fatal(err)
+	}
+	// cat echoes the request, which is a valid reply
+	d := cfg.LocalDirs[1]
+	if m, err := d.Media("/foo/The.Wire.S01E01"); err != nil || m.Release != "The.Wire.S01E01" {
+		t.Fatalf("Expected Release=The.Wire.S01E01, got %+v (%v)", m, err)
+	}
+	if err := cfg.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadExtraTemplate(t *testing.T) {
+	cfg := Config{
+		Parsers: []Parser{{
+			Name:     "daily",
+			Patterns: []string{`^(?P<name>.+?)\.(?P<year>\d{4})\.(?P<month>\d{2})\.`},
+		}},
+		LocalDirs: []LocalDir{
+			{Name: "d1", Parser: "daily", Dir: "/tv/{{ .Name }}/{{ .Year }}-{{ .Extra.month | upper }}/"},
+		},
+	}
+	if err := cfg.load(); err != nil {
+		t.Fatal(err)
+	}
+	d := cfg.LocalDirs[0]
+	m, err := d.Media("The.Daily.Show.2017.03.14.720p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := d.Path(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/tv/The.Daily.Show/2017-03/The.Daily.Show.2017.03.14.720p"; path != want {
+		t.Errorf("want %q, got %q", want, path)
+	}
+}
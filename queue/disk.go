@@ -0,0 +1,60 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// existingDir returns the deepest existing directory of path
+func existingDir(path string) string {
+	for {
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+func (q *Queue) applyFreeSpace() {
+	if q.localDir.minFreeSpace == 0 {
+		return
+	}
+	var items []*Item
+	for _, item := range q.Transferable() {
+		if !item.Merged {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return
+	}
+	// Media from the same local dir is likely stored on the same filesystem, so checking the template root is enough
+	root := q.localDir.root
+	if root == "" {
+		root = items[0].LocalPath
+	}
+	free, err := q.localDir.freeSpace(existingDir(root))
+	if err != nil {
+		for _, item := range items {
+			item.reject(fmt.Sprintf("DiskFull=unknown: %s", err))
+		}
+		return
+	}
+	// Keep the highest ranked items that fit
+	sort.SliceStable(items, func(i, j int) bool { return q.compare(items[i], items[j]) > 0 })
+	available := free - q.localDir.minFreeSpace
+	for _, item := range items {
+		if available <= 0 || item.Size > available {
+			item.reject(fmt.Sprintf("DiskFull=true Size=%s Free=%s MinFreeSpace=%s",
+				FormatSize(item.Size), FormatSize(free), q.localDir.MinFreeSpace))
+			continue
+		}
+		available -= item.Size
+	}
+}
@@ -0,0 +1,11 @@
+package queue
+
+import "syscall"
+
+func diskFree(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.F_bavail) * int64(st.F_bsize), nil
+}
@@ -0,0 +1,13 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!openbsd
+
+package queue
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func diskFree(path string) (int64, error) {
+	return 0, fmt.Errorf("free space is not supported on %s", runtime.GOOS)
+}
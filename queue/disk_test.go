@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestExistingDir(t *testing.T) {
+	dir := os.TempDir()
+	if got := existingDir(dir + "/lftpq-does-not-exist/foo"); got != dir {
+		t.Errorf("want %q, got %q", dir, got)
+	}
+}
+
+func TestApplyFreeSpace(t *testing.T) {
+	s := newTestSite()
+	s.priorities = []*regexp.Regexp{regexp.MustCompile("1080p"), regexp.MustCompile("720p")}
+	s.localDir.MinFreeSpace = "1GB"
+	s.localDir.minFreeSpace = 1e9
+	var checked string
+	s.localDir.freeSpace = func(path string) (int64, error) {
+		checked = path
+		return 4e9, nil
+	}
+	files := []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01.720p", size: 1e9},
+		file{name: "/remote/The.Wire.S01E02.1080p", size: 2.5e9},
+		file{name: "/remote/The.Wire.S01E03.720p", size: 4e8},
+	}
+	q := newTestQueue(s, files)
+	var tests = []struct {
+		i      int
+		reason string
+	}{
+		{0, "DiskFull=true Size=953.7 MiB Free=3.7 GiB MinFreeSpace=1GB"},
+		{1, "Match=.*"},
+		{2, "Match=.*"},
+	}
+	for _, tt := range tests {
+		if got := q.Items[tt.i].Reason; got != tt.reason {
+			t.Errorf("want %q, got %q", tt.reason, got)
+		}
+	}
+	if checked != "/" {
+		t.Errorf("want free space checked in %q, got %q", "/", checked)
+	}
+
+	s.localDir.freeSpace = func(path string) (int64, error) { return 0, fmt.Errorf("error") }
+	q = newTestQueue(s, files)
+	if got := len(q.Transferable()); got != 0 {
+		t.Errorf("want 0 transferable items, got %d", got)
+	}
+}
+
+func TestApplyFreeSpaceSkipExisting(t *testing.T) {
+	s := newTestSite()
+	s.SkipExisting = true
+	s.priorities = []*regexp.Regexp{regexp.MustCompile("1080p"), regexp.MustCompile("720p")}
+	s.localDir.minFreeSpace = 1e9
+	s.localDir.freeSpace = func(path string) (int64, error) { return 3e9, nil }
+	files := []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01.1080p", size: 1.5e9},
+		file{name: "/remote/The.Wire.S01E02.720p", size: 1e9},
+	}
+	readDir := func(dirname string) ([]os.FileInfo, error) {
+		if dirname == "/local/The.Wire/S1/The.Wire.S01E01.1080p" {
+			return []os.FileInfo{file{name: "foo.mkv"}}, nil
+		}
+		return nil, nil
+	}
+	q := newQueue(s, files, readDir, nil)
+	// The existing item does not use up free space
+	var tests = []struct {
+		i      int
+		reason string
+	}{
+		{0, "IsDstDirEmpty=false"},
+		{1, "Match=.*"},
+	}
+	for _, tt := range tests {
+		if got := q.Items[tt.i].Reason; got != tt.reason {
+			t.Errorf("want %q, got %q", tt.reason, got)
+		}
+	}
+}
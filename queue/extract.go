@@ -0,0 +1,245 @@
+package queue
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	partPattern   = regexp.MustCompile(`(?i)^(.+)\.part(\d+)\.rar$`)
+	volumePattern = regexp.MustCompile(`(?i)^(.+)\.([rs])(\d{2})$`)
+)
+
+type extractFunc func(dir, archive string) error
+
+// archive is a set of volumes making up a single archive. The first volume is the one passed to the extractor.
+type archive struct {
+	dir     string
+	key     string
+	first   string
+	parts   bool
+	volumes []string
+	missing []string
+}
+
+func (a *archive) path() string { return filepath.Join(a.dir, a.first) }
+
+func (a *archive) complete() error {
+	if len(a.missing) > 0 {
+		return fmt.Errorf("incomplete archive: %q: missing %s", a.path(), strings.Join(a.missing, ", "))
+	}
+	return nil
+}
+
+// volume returns the key of the archive set that name belongs to and its volume number. Multi-volume RAR archives are
+// either named "<name>.part1.rar", "<name>.part2.rar", ... or "<name>.rar", "<name>.r00", "<name>.r01", ..., where
+// volume 100 is named "<name>.s00".
+func volume(name string) (key string, n int, parts bool, ok bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if m := partPattern.FindStringSubmatch(name); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		return m[1] + ".part.rar", n, true, true
+	} else if ext == ".rar" {
+		// The first volume of an old-style set is numbered -1 so that it sorts before .r00
+		return strings.TrimSuffix(name, filepath.Ext(name)), -1, false, true
+	} else if ext == ".zip" {
+		return name, -1, false, true
+	} else if m := volumePattern.FindStringSubmatch(name); m != nil {
+		n, _ := strconv.Atoi(m[3])
+		return m[1], int(strings.ToLower(m[2])[0]-'r')*100 + n, false, true
+	}
+	return "", 0, false, false
+}
+
+// findArchives groups the archive volumes found in dir. Gaps in the numbering, including a missing first volume, are
+// recorded as missing volumes.
+func findArchives(dir string, names []string) []*archive {
+	sets := map[string]*archive{}
+	numbers := map[string]map[int]string{}
+	for _, name := range names {
+		key, n, parts, ok := volume(name)
+		if !ok {
+			continue
+		}
+		a, ok := sets[key]
+		if !ok {
+			a = &archive{dir: dir, key: key, parts: parts}
+			sets[key] = a
+			numbers[key] = map[int]string{}
+		}
+		numbers[key][n] = name
+	}
+	var archives []*archive
+	for key, a := range sets {
+		nums := numbers[key]
+		first, last := -1, -1
+		for n := range nums {
+			if n > last {
+				last = n
+			}
+		}
+		if a.parts {
+			first = 1
+			if _, ok := nums[0]; ok {
+				first = 0
+			}
+		}
+		for n := first; n <= last; n++ {
+			if name, ok := nums[n]; ok {
+				a.volumes = append(a.volumes, name)
+			} else {
+				a.missing = append(a.missing, volumeName(nums, n))
+			}
+		}
+		a.first = volumeName(nums, first)
+		archives = append(archives, a)
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].first < archives[j].first })
+	return archives
+}
+
+// volumeName returns the name of volume n, given the existing volumes of an archive.
+func volumeName(nums map[int]string, n int) string {
+	name, ok := nums[n]
+	if ok {
+		return name
+	}
+	for _, name = range nums {
+		break
+	}
+	if m := partPattern.FindStringSubmatch(name); m != nil {
+		return fmt.Sprintf("%s.part%0*d.rar", m[1], len(m[2]), n)
+	}
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if n < 0 {
+		return base + ".rar"
+	}
+	return fmt.Sprintf("%s.%c%02d", base, 'r'+n/100, n%100)
+}
+
+func listFiles(path string) (map[string]bool, error) {
+	files := map[string]bool{}
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			files[p] = true
+		}
+		return nil
+	})
+	return files, err
+}
+
+func extractCommand(program string, args []string) extractFunc {
+	return func(dir, archive string) error {
+		cmd := exec.Command(program, append(append([]string{}, args...), archive)...)
+		cmd.Dir = dir
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("%s: %w: %s", filepath.Base(program), err, msg)
+			}
+			return fmt.Errorf("%s: %w", filepath.Base(program), err)
+		}
+		return nil
+	}
+}
+
+// verifyArchive checks the volumes of archive against any checksums listed for them. Checksums of volumes belonging to
+// other archives in the same dir are ignored.
+func verifyArchive(a *archive, sums []checksum) error {
+	volumes := map[string]bool{}
+	for _, v := range a.volumes {
+		volumes[filepath.Join(a.dir, v)] = true
+	}
+	for _, sum := range sums {
+		if filepath.Dir(sum.path) != a.dir {
+			continue
+		}
+		if key, _, _, ok := volume(filepath.Base(sum.path)); !ok || key != a.key {
+			continue
+		}
+		if !volumes[sum.path] {
+			return fmt.Errorf("incomplete archive: %q: missing %s", a.path(), filepath.Base(sum.path))
+		}
+		if err := sum.verify(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extract extracts the archives contained in the local path of this item into the directory of each archive. Archives
+// are checked for missing volumes, and against any checksum files, before extraction.
+func (i *Item) extract() {
+	i.Extracted = nil
+	i.ExtractError = ""
+	before, err := listFiles(i.LocalPath)
+	if err != nil {
+		i.ExtractError = err.Error()
+		return
+	}
+	dirs := map[string][]string{}
+	for path := range before {
+		dirs[filepath.Dir(path)] = append(dirs[filepath.Dir(path)], filepath.Base(path))
+	}
+	var sums []checksum
+	// Checksums have already been checked if the item is verified
+	if !i.Verified {
+		if sums, err = findChecksums(i.LocalPath); err != nil {
+			i.ExtractError = err.Error()
+			return
+		}
+	}
+	var archives []*archive
+	for dir, names := range dirs {
+		archives = append(archives, findArchives(dir, names)...)
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].path() < archives[j].path() })
+	for _, a := range archives {
+		if err := a.complete(); err != nil {
+			i.ExtractError = err.Error()
+			return
+		}
+		if err := verifyArchive(a, sums); err != nil {
+			i.ExtractError = err.Error()
+			return
+		}
+	}
+	for _, a := range archives {
+		if err := i.localDir.extract(a.dir, a.first); err != nil {
+			i.ExtractError = fmt.Sprintf("%s: %s", a.path(), err)
+			break
+		}
+	}
+	after, err := listFiles(i.LocalPath)
+	if err != nil && i.ExtractError == "" {
+		i.ExtractError = err.Error()
+	}
+	for path := range after {
+		if !before[path] {
+			i.Extracted = append(i.Extracted, path)
+		}
+	}
+	sort.Strings(i.Extracted)
+}
+
+// Extract extracts archives in the transferable items of this queue, if the local dir has an ExtractCommand. Items that
+// failed verification are not extracted.
+func (q *Queue) Extract() {
+	for _, item := range q.Transferable() {
+		if item.localDir.extract == nil || item.VerifyError != "" {
+			continue
+		}
+		item.extract()
+	}
+}
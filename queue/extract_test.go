@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindArchives(t *testing.T) {
+	var tests = []struct {
+		names   []string
+		first   []string
+		missing [][]string
+	}{
+		{[]string{"foo.rar", "foo.r00", "foo.r01", "foo.sfv", "foo.nfo"}, []string{"foo.rar"}, [][]string{nil}},
+		{[]string{"foo.rar", "foo.r00", "foo.r02"}, []string{"foo.rar"}, [][]string{{"foo.r01"}}},
+		{[]string{"foo.r00", "foo.r01"}, []string{"foo.rar"}, [][]string{{"foo.rar"}}},
+		{[]string{"foo.part01.rar", "foo.part02.rar", "foo.part04.rar"}, []string{"foo.part01.rar"}, [][]string{{"foo.part03.rar"}}},
+		{[]string{"foo.part2.rar"}, []string{"foo.part1.rar"}, [][]string{{"foo.part1.rar"}}},
+		{[]string{"bar.zip", "foo.rar"}, []string{"bar.zip", "foo.rar"}, [][]string{nil, nil}},
+		{[]string{"foo.mkv", "foo.nfo"}, nil, nil},
+	}
+	for i, tt := range tests {
+		var (
+			first   []string
+			missing [][]string
+		)
+		for _, a := range findArchives("/d", tt.names) {
+			first = append(first, a.first)
+			missing = append(missing, a.missing)
+		}
+		if !reflect.DeepEqual(tt.first, first) || !reflect.DeepEqual(tt.missing, missing) {
+			t.Errorf("#%d: want %q %q, got %q %q", i, tt.first, tt.missing, first, missing)
+		}
+	}
+	// Volume 100 of an old-style set is named .s00
+	names := []string{"foo.rar"}
+	for n := 0; n < 101; n++ {
+		names = append(names, volumeName(map[int]string{-1: "foo.rar"}, n))
+	}
+	if got := names[len(names)-1]; got != "foo.s00" {
+		t.Errorf("want %q, got %q", "foo.s00", got)
+	}
+	if archives := findArchives("/d", names); len(archives) != 1 || len(archives[0].volumes) != 102 {
+		t.Errorf("want 1 archive with 102 volumes, got %+v", archives)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lftpq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, data string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("ok/foo.rar", "foo")
+	write("ok/foo.r00", "foo")
+	write("ok/foo.sfv", "foo.rar 8c736521\nfoo.r00 8c736521\n")
+	write("ok/Subs/subs.rar", "foo")
+	write("missing/foo.rar", "foo")
+	write("missing/foo.r01", "foo")
+	write("corrupt/foo.rar", "bar")
+	write("corrupt/foo.sfv", "foo.rar 8c736521\n")
+	write("none/foo.mkv", "foo")
+	write("sets/a.rar", "foo")
+	write("sets/a.r00", "foo")
+	write("sets/a.sfv", "a.rar 8c736521\na.r00 8c736521\n")
+	write("sets/b.rar", "bar")
+	write("unverified/foo.rar", "foo")
+
+	var extracted []string
+	s := newTestSite()
+	s.localDir.extract = func(dir, archive string) error {
+		extracted = append(extracted, filepath.Join(dir, archive))
+		return ioutil.WriteFile(filepath.Join(dir, archive+".out"), nil, 0644)
+	}
+	q := Queue{Site: s}
+	for _, name := range []string{"ok", "missing", "corrupt", "none", "sets", "unverified"} {
+		q.Items = append(q.Items, Item{LocalPath: filepath.Join(dir, name), Transfer: true, localDir: s.localDir})
+	}
+	q.Items[5].VerifyError = "checksum mismatch"
+	q.Extract()
+
+	want := []string{
+		filepath.Join(dir, "ok/Subs/subs.rar"),
+		filepath.Join(dir, "ok/foo.rar"),
+		filepath.Join(dir, "sets/a.rar"),
+		filepath.Join(dir, "sets/b.rar"),
+	}
+	if !reflect.DeepEqual(want, extracted) {
+		t.Errorf("want %q extracted, got %q", want, extracted)
+	}
+	var tests = []struct {
+		extracted []string
+		err       string
+	}{
+		{[]string{filepath.Join(dir, "ok/Subs/subs.rar.out"), filepath.Join(dir, "ok/foo.rar.out")}, ""},
+		{nil, "incomplete archive: \"" + filepath.Join(dir, "missing/foo.rar") + "\": missing foo.r00"},
+		{nil, "checksum mismatch: \"" + filepath.Join(dir, "corrupt/foo.rar") + "\": want 8c736521, got 76ff8caa"},
+		{nil, ""},
+		// Checksums of one archive do not apply to another in the same dir
+		{[]string{filepath.Join(dir, "sets/a.rar.out"), filepath.Join(dir, "sets/b.rar.out")}, ""},
+		{nil, ""},
+	}
+	for i, tt := range tests {
+		item := q.Items[i]
+		if !reflect.DeepEqual(tt.extracted, item.Extracted) || item.ExtractError != tt.err {
+			t.Errorf("#%d: want (%q, %q), got (%q, %q)", i, tt.extracted, tt.err, item.Extracted, item.ExtractError)
+		}
+	}
+}
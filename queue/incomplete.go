@@ -0,0 +1,131 @@
+package queue
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultIncompleteTags matches the tags commonly created by site scripts while a release is uploading, e.g.
+// "[incomplete]-Foo" or "[ 45% Complete ]".
+var defaultIncompleteTags = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\bincomplete\b`),
+	regexp.MustCompile(`(?i)\b\d{1,2}% complete\b`),
+}
+
+// Lister lists and reads files on a site.
+type Lister interface {
+	List(path string) ([]os.FileInfo, error)
+	Cat(path string) ([]byte, error)
+}
+
+func (s *Site) tags() []*regexp.Regexp {
+	if len(s.incompleteTags) == 0 {
+		return defaultIncompleteTags
+	}
+	return s.incompleteTags
+}
+
+// incomplete inspects the remote dir of item and returns a reason if it appears to be incomplete. A dir is incomplete if
+// it contains a completion tag matching IncompleteTags, a ".missing" marker, or if files listed in an SFV file are not
+// present.
+func (q *Queue) incomplete(item *Item, files []os.FileInfo, lister Lister) (string, bool) {
+	present := make(map[string]bool, len(files))
+	for _, f := range files {
+		present[strings.ToLower(filepath.Base(f.Name()))] = true
+	}
+	for _, f := range files {
+		name := filepath.Base(f.Name())
+		for _, tag := range q.tags() {
+			if tag.MatchString(name) {
+				return fmt.Sprintf("Incomplete=true Tag=%s", name), true
+			}
+		}
+		if strings.HasSuffix(strings.ToLower(name), ".missing") {
+			return fmt.Sprintf("Incomplete=true Missing=%s", name[:len(name)-len(".missing")]), true
+		}
+	}
+	for _, f := range files {
+		if !f.Mode().IsRegular() || strings.ToLower(filepath.Ext(f.Name())) != ".sfv" {
+			continue
+		}
+		data, err := lister.Cat(f.Name())
+		if err != nil {
+			return fmt.Sprintf("Incomplete=unknown: %s", err), true
+		}
+		sums, err := parseChecksums(bytes.NewReader(data), "", ".sfv")
+		if err != nil {
+			return fmt.Sprintf("Incomplete=unknown: %s: %s", filepath.Base(f.Name()), err), true
+		}
+		for _, sum := range sums {
+			// Files in subdirectories are not listed
+			if strings.ContainsRune(sum.path, filepath.Separator) {
+				continue
+			}
+			if !present[strings.ToLower(sum.path)] {
+				return fmt.Sprintf("Incomplete=true Missing=%s", sum.path), true
+			}
+		}
+	}
+	return "", false
+}
+
+// quiet returns a reason if item, or any of the given files, has been modified more recently than MinQuietAge.
+func (q *Queue) quiet(item *Item, files []os.FileInfo) (string, bool) {
+	modTime := item.ModTime
+	for _, f := range files {
+		if f.ModTime().After(modTime) {
+			modTime = f.ModTime()
+		}
+	}
+	if age := q.now.Round(time.Second).Sub(modTime); age < q.minQuietAge {
+		return fmt.Sprintf("QuietAge=%s MinQuietAge=%s", age, q.minQuietAge), true
+	}
+	return "", false
+}
+
+// inspect rejects transferable items whose remote dir is incomplete or has recently been modified. Such items are
+// considered again in later runs. Items already in inspected are skipped, and the indices of rejected items are
+// returned.
+func (q *Queue) inspect(lister Lister, inspected map[string]bool) []int {
+	if lister == nil || (!q.CheckIncomplete && q.minQuietAge == 0) {
+		return nil
+	}
+	var rejected []int
+	for i := range q.Items {
+		item := &q.Items[i]
+		// Merged items are already on disk
+		if !item.Transfer || item.Merged || inspected[item.RemotePath] {
+			continue
+		}
+		inspected[item.RemotePath] = true
+		if reason, ok := q.inspectItem(item, lister); ok {
+			item.reject(reason)
+			rejected = append(rejected, i)
+		}
+	}
+	return rejected
+}
+
+func (q *Queue) inspectItem(item *Item, lister Lister) (string, bool) {
+	var files []os.FileInfo
+	if !item.isFile {
+		var err error
+		if files, err = lister.List(item.RemotePath); err != nil {
+			return fmt.Sprintf("Incomplete=unknown: %s", err), true
+		}
+	}
+	if q.CheckIncomplete {
+		if reason, ok := q.incomplete(item, files, lister); ok {
+			return reason, true
+		}
+	}
+	if q.minQuietAge > 0 {
+		return q.quiet(item, files)
+	}
+	return "", false
+}
@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+type testLister struct {
+	dirs   map[string][]os.FileInfo
+	files  map[string]string
+	listed []string
+}
+
+func (l *testLister) List(path string) ([]os.FileInfo, error) {
+	l.listed = append(l.listed, path)
+	files, ok := l.dirs[path]
+	if !ok {
+		return nil, fmt.Errorf("read error")
+	}
+	return files, nil
+}
+
+func (l *testLister) Cat(path string) ([]byte, error) {
+	data, ok := l.files[path]
+	if !ok {
+		return nil, fmt.Errorf("read error")
+	}
+	return []byte(data), nil
+}
+
+func TestInspect(t *testing.T) {
+	now := time.Now().Round(time.Second)
+	old := now.Add(-time.Hour)
+	lister := &testLister{
+		dirs: map[string][]os.FileInfo{
+			"/remote/The.Wire.S01E01": {
+				file{name: "/remote/The.Wire.S01E01/foo.rar", modTime: old},
+				file{name: "/remote/The.Wire.S01E01/foo.sfv", modTime: old},
+			},
+			"/remote/The.Wire.S01E02": {
+				file{name: "/remote/The.Wire.S01E02/foo.rar", modTime: old},
+				file{name: "/remote/The.Wire.S01E02/[ 45% Complete ]", mode: os.ModeDir, modTime: old},
+			},
+			"/remote/The.Wire.S01E03": {
+				file{name: "/remote/The.Wire.S01E03/foo.rar", modTime: old},
+				file{name: "/remote/The.Wire.S01E03/foo.r00.missing", modTime: old},
+			},
+			"/remote/The.Wire.S01E04": {
+				file{name: "/remote/The.Wire.S01E04/foo.rar", modTime: old},
+				file{name: "/remote/The.Wire.S01E04/foo.sfv", modTime: old},
+			},
+			"/remote/The.Wire.S01E05": {
+				file{name: "/remote/The.Wire.S01E05/foo.rar", modTime: now.Add(-time.Minute)},
+			},
+		},
+		files: map[string]string{
+			"/remote/The.Wire.S01E01/foo.sfv": "; comment\nFOO.RAR 8c736521\n",
+			"/remote/The.Wire.S01E04/foo.sfv": "foo.rar 8c736521\nfoo.r00 8c736521\n",
+		},
+	}
+	s := newTestSite()
+	s.CheckIncomplete = true
+	s.MinQuietAge = "10m"
+	s.minQuietAge = 10 * time.Minute
+	files := []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01", mode: os.ModeDir, modTime: old},
+		file{name: "/remote/The.Wire.S01E02", mode: os.ModeDir, modTime: old},
+		file{name: "/remote/The.Wire.S01E03", mode: os.ModeDir, modTime: old},
+		file{name: "/remote/The.Wire.S01E04", mode: os.ModeDir, modTime: old},
+		file{name: "/remote/The.Wire.S01E05", mode: os.ModeDir, modTime: old},
+		file{name: "/remote/The.Wire.S01E06", mode: os.ModeDir, modTime: old},
+		file{name: "/remote/The.Wire.S01E07.mkv", modTime: now.Add(-time.Minute)},
+	}
+	q := newQueue(s, files, func(dirname string) ([]os.FileInfo, error) { return nil, nil }, lister)
+	var tests = []struct {
+		transfer bool
+		reason   string
+	}{
+		{true, "Match=.*"},
+		{false, "Incomplete=true Tag=[ 45% Complete ]"},
+		{false, "Incomplete=true Missing=foo.r00"},
+		{false, "Incomplete=true Missing=foo.r00"},
+		{false, "QuietAge=1m0s MinQuietAge=10m0s"},
+		{false, "Incomplete=unknown: read error"},
+		{false, "QuietAge=1m0s MinQuietAge=10m0s"},
+	}
+	for i, tt := range tests {
+		item := q.Items[i]
+		if item.Transfer != tt.transfer || item.Reason != tt.reason {
+			t.Errorf("#%d: want (%t, %q), got (%t, %q) for %s", i, tt.transfer, tt.reason, item.Transfer, item.Reason, item.RemotePath)
+		}
+	}
+
+	// Custom tags replace the default ones
+	s.MinQuietAge = ""
+	s.minQuietAge = 0
+	s.incompleteTags = []*regexp.Regexp{regexp.MustCompile(`^foo\.rar$`)}
+	q = newQueue(s, files[:1], func(dirname string) ([]os.FileInfo, error) { return nil, nil }, lister)
+	if want, got := "Incomplete=true Tag=foo.rar", q.Items[0].Reason; want != got {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestInspectDuplicates(t *testing.T) {
+	lister := &testLister{
+		dirs: map[string][]os.FileInfo{
+			"/remote/The.Wire.S01E01.720p.BluRay-GRP": {
+				file{name: "/remote/The.Wire.S01E01.720p.BluRay-GRP/[incomplete]-The.Wire", mode: os.ModeDir},
+			},
+			"/remote/The.Wire.S01E01.720p.WEB-DL-GRP": {
+				file{name: "/remote/The.Wire.S01E01.720p.WEB-DL-GRP/foo.rar"},
+			},
+		},
+	}
+	s := newTestSite()
+	s.CheckIncomplete = true
+	s.priorities = []*regexp.Regexp{regexp.MustCompile(`\.BluRay-`), regexp.MustCompile(`\.WEB-DL-`)}
+	files := []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01.720p.BluRay-GRP", mode: os.ModeDir},
+		file{name: "/remote/The.Wire.S01E01.720p.HDTV-GRP", mode: os.ModeDir},
+		file{name: "/remote/The.Wire.S01E01.720p.WEB-DL-GRP", mode: os.ModeDir},
+	}
+	q := newQueue(s, files, func(dirname string) ([]os.FileInfo, error) { return nil, nil }, lister)
+	// The complete duplicate takes the place of the deferred item
+	var tests = []struct {
+		transfer bool
+		reason   string
+	}{
+		{false, "Incomplete=true Tag=[incomplete]-The.Wire"},
+		{false, "DuplicateOf=/remote/The.Wire.S01E01.720p.WEB-DL-GRP Rank=0"},
+		{true, "Match=.*"},
+	}
+	for i, tt := range tests {
+		item := q.Items[i]
+		if item.Transfer != tt.transfer || item.Reason != tt.reason {
+			t.Errorf("#%d: want (%t, %q), got (%t, %q) for %s", i, tt.transfer, tt.reason, item.Transfer, item.Reason, item.RemotePath)
+		}
+	}
+	// Only the items remaining after deduplication are listed
+	want := []string{"/remote/The.Wire.S01E01.720p.BluRay-GRP", "/remote/The.Wire.S01E01.720p.WEB-DL-GRP"}
+	if !reflect.DeepEqual(want, lister.listed) {
+		t.Errorf("want %q listed, got %q", want, lister.listed)
+	}
+
+	// On-disk duplicates merged for a deferred item are removed again
+	s.Merge = true
+	readDir := func(dirname string) ([]os.FileInfo, error) {
+		return []os.FileInfo{file{name: "The.Wire.S01E01.720p.HDTV-GRP"}}, nil
+	}
+	q = newQueue(s, files[:1], readDir, lister)
+	if len(q.Items) != 1 {
+		t.Fatalf("want 1 item, got %d", len(q.Items))
+	}
+	if item := q.Items[0]; item.Transfer || item.Merged {
+		t.Errorf("want Transfer=false Merged=false, got Transfer=%t Merged=%t for %s", item.Transfer, item.Merged, item.RemotePath)
+	}
+}
@@ -1,22 +1,36 @@
 package queue
 
 import (
+	"fmt"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/mpolden/lftpq/parser"
 )
 
 type Item struct {
-	RemotePath string
-	LocalPath  string
-	ModTime    time.Time
-	Transfer   bool
-	Reason     string
-	Media      parser.Media
-	Duplicate  bool
-	Merged     bool
-	localDir   LocalDir
+	RemotePath   string
+	LocalPath    string
+	ModTime      time.Time
+	Size         int64
+	Transfer     bool
+	Reason       string
+	Media        parser.Media
+	Duplicate    bool
+	Merged       bool
+	Delete       bool
+	Score        int
+	ScoreDetails []string
+	Verified     bool
+	VerifyError  string
+	Extracted    []string
+	ExtractError string
+	localDir     LocalDir
+	isFile       bool
+	corrupt      []string
 }
 
 func (i *Item) isEmpty(readDir readDir) bool {
@@ -34,17 +48,28 @@ func (i *Item) reject(reason string) {
 	i.Reason = reason
 }
 
-func (i *Item) duplicates(readDir readDir) []Item {
+func (i *Item) supersede(by *Item, delete bool) {
+	i.Duplicate = true
+	i.Delete = i.Merged && delete
+	i.reject(fmt.Sprintf("SupersededBy=%s Revision=%d", by.RemotePath, i.Media.Revision))
+}
+
+func (i *Item) duplicates(readDir readDir, equal func(a, b *parser.Media) bool) []Item {
 	var items []Item
 	parent := filepath.Join(i.LocalPath, "..")
 	dirs, _ := readDir(parent)
+	names := make([]string, len(dirs))
+	for j, fi := range dirs {
+		names[j] = fi.Name()
+	}
+	i.localDir.Prefetch(names)
 	for _, fi := range dirs {
 		// Ignore self
 		if filepath.Base(i.RemotePath) == fi.Name() {
 			continue
 		}
 		path := filepath.Join(parent, fi.Name())
-		item, err := newItem(path, i.ModTime, i.localDir)
+		item, err := newItem(path, i.Media.Segments, i.ModTime, i.localDir)
 		if err != nil {
 			item.reject(err.Error())
 		} else {
@@ -52,7 +77,7 @@ func (i *Item) duplicates(readDir readDir) []Item {
 			item.Merged = true
 		}
 		// Ignore unequal media
-		if !i.Media.Equal(item.Media) {
+		if !equal(&i.Media, &item.Media) {
 			continue
 		}
 		items = append(items, item)
@@ -60,14 +85,30 @@ func (i *Item) duplicates(readDir readDir) []Item {
 	return items
 }
 
-func newItem(remotePath string, modTime time.Time, localDir LocalDir) (Item, error) {
+// match returns whether pattern p matches the name of this item. Patterns containing a slash match the path relative
+// to the remote dir instead, including any segments matched by globs.
+func (i *Item) match(p *regexp.Regexp) bool {
+	name := filepath.Base(i.RemotePath)
+	if strings.Contains(p.String(), "/") {
+		name = path.Join(append(append([]string{}, i.Media.Segments...), name)...)
+	}
+	return p.MatchString(name)
+}
+
+func (i *Item) supersedes(o *Item) bool {
+	return i.Media.Group != "" && strings.EqualFold(i.Media.Group, o.Media.Group) &&
+		i.Media.Revision > o.Media.Revision
+}
+
+func newItem(remotePath string, segments []string, modTime time.Time, localDir LocalDir) (Item, error) {
 	item := Item{RemotePath: remotePath, ModTime: modTime, Reason: "no match", localDir: localDir}
 	media, err := localDir.Media(remotePath)
 	if err != nil {
 		return Item{}, err
 	}
+	media.Segments = segments
 	item.Media = media
-	item.LocalPath, err = media.PathIn(localDir.Template)
+	item.LocalPath, err = localDir.Path(media)
 	if err != nil {
 		return Item{}, err
 	}
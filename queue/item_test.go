@@ -11,7 +11,7 @@ import (
 )
 
 func newTestItem(remotePath string, localDir LocalDir) Item {
-	item, _ := newItem(remotePath, time.Time{}, localDir)
+	item, _ := newItem(remotePath, nil, time.Time{}, localDir)
 	return item
 }
 
@@ -52,7 +52,7 @@ func TestNewItemDefaultParser(t *testing.T) {
 }
 
 func TestNewItemUnparsable(t *testing.T) {
-	_, err := newItem("/foo/bar", time.Time{}, showDir())
+	_, err := newItem("/foo/bar", nil, time.Time{}, showDir())
 	if err == nil {
 		t.Fatal("Expected error")
 	}
@@ -82,6 +82,39 @@ func TestNewItemWithReplacements(t *testing.T) {
 	}
 }
 
+func TestNewItemWithAliases(t *testing.T) {
+	tmpl := showDir()
+	tmpl.aliases = compileAliases(map[string]string{
+		"Marvels.Agents.of.SHIELD": "Marvels.Agents.of.S.H.I.E.L.D",
+		"The.Office.US":            "The.Office.(US)",
+		"Doctor.Who":               "Doctor.Who.(2005)",
+		"Agents.of.SHIELD":         "Marvels.Agents.of.S.H.I.E.L.D",
+		"Shield":                   "Marvels.Agents.of.S.H.I.E.L.D",
+	})
+	var tests = []struct {
+		in  Item
+		out string
+	}{
+		{newTestItem("/foo/Marvels.Agents.of.SHIELD.S01E01", tmpl), "Marvels.Agents.of.S.H.I.E.L.D"},
+		{newTestItem("/foo/marvels.agents.of.s.h.i.e.l.d.S01E01", tmpl), "Marvels.Agents.of.S.H.I.E.L.D"},
+		{newTestItem("/foo/The.Office.US.S01E01", tmpl), "The.Office.(US)"},
+		{newTestItem("/foo/Office.US.S01E01", tmpl), "The.Office.(US)"},
+		{newTestItem("/foo/The.Office.UK.S01E01", tmpl), "The.Office.UK"},
+		{newTestItem("/foo/Doctor.Who.2005.S01E01", tmpl), "Doctor.Who.(2005)"},
+		{newTestItem("/foo/Doctor.Who.S01E01", tmpl), "Doctor.Who.(2005)"},
+		{newTestItem("/foo/Doctor.Who.1963.S01E01", tmpl), "Doctor.Who.1963"},
+		{newTestItem("/foo/Agents.of.SHIELD.S01E01", tmpl), "Marvels.Agents.of.S.H.I.E.L.D"},
+		{newTestItem("/foo/Agents.of.S.H.I.E.L.D.S01E01", tmpl), "Marvels.Agents.of.S.H.I.E.L.D"},
+		{newTestItem("/foo/Shield.S01E01", tmpl), "Marvels.Agents.of.S.H.I.E.L.D"},
+		{newTestItem("/foo/Shield.UK.S01E01", tmpl), "Shield.UK"},
+	}
+	for _, tt := range tests {
+		if tt.in.Media.Name != tt.out {
+			t.Errorf("Expected %q, got %q", tt.out, tt.in.Media.Name)
+		}
+	}
+}
+
 func TestLocalPath(t *testing.T) {
 	var tests = []struct {
 		remotePath string
@@ -8,11 +8,12 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/mpolden/lftpq/parser"
 )
 
 var fieldSplitter = regexp.MustCompile(`\s+`)
@@ -26,6 +27,7 @@ type Consumer interface {
 type Queue struct {
 	Site
 	Items []Item
+	now   time.Time
 }
 
 func lookupSite(name string, sites []Site) (Site, error) {
@@ -37,8 +39,8 @@ func lookupSite(name string, sites []Site) (Site, error) {
 	return Site{}, fmt.Errorf("no such site: %s", name)
 }
 
-func New(site Site, files []os.FileInfo) Queue {
-	return newQueue(site, files, ioutil.ReadDir)
+func New(site Site, files []os.FileInfo, lister Lister) Queue {
+	return newQueue(site, files, ioutil.ReadDir, lister)
 }
 
 func Read(sites []Site, r io.Reader) ([]Queue, error) {
@@ -58,12 +60,12 @@ func Read(sites []Site, r io.Reader) ([]Queue, error) {
 		}
 		i, ok := indices[site.Name]
 		if !ok {
-			qs = append(qs, Queue{Site: site})
+			qs = append(qs, Queue{Site: site, now: time.Now()})
 			i = len(qs) - 1
 			indices[site.Name] = i
 		}
 		q := &qs[i]
-		item, err := newItem(fields[1], time.Time{}, q.localDir)
+		item, err := newItem(fields[1], q.segments(fields[1]), time.Time{}, q.localDir)
 		if err != nil {
 			item.reject(err.Error())
 		} else {
@@ -84,6 +86,15 @@ func (q *Queue) Transferable() []*Item {
 	return items
 }
 
+// TransferSize returns the total size of transferable items
+func (q *Queue) TransferSize() int64 {
+	var size int64
+	for _, item := range q.Transferable() {
+		size += item.Size
+	}
+	return size
+}
+
 func (q *Queue) Transfer(consumer Consumer) error {
 	name, err := q.tempFile()
 	if err != nil {
@@ -110,6 +121,33 @@ func (q *Queue) PostProcess(inheritIO bool) error {
 	return cmd.Run()
 }
 
+// getCmd returns the lftp command used to transfer item. Whether an item is a file is known from the listing, while
+// imported items are assumed to be directories.
+func (q *Queue) getCmd(item *Item) string {
+	for _, o := range q.GetCmdOverrides {
+		if o.match(item) {
+			return o.Command
+		}
+	}
+	if item.isFile && q.GetFileCmd != "" {
+		return q.GetFileCmd
+	}
+	if !item.isFile && q.GetDirCmd != "" {
+		return q.GetDirCmd
+	}
+	return q.GetCmd
+}
+
+// outputFlag returns whether cmd takes the local path as an -o option following the remote path, like get and pget,
+// rather than as the second argument, like mirror.
+func outputFlag(cmd string) bool {
+	name := cmd
+	if i := strings.IndexByte(cmd, ' '); i != -1 {
+		name = cmd[:i]
+	}
+	return name == "get" || name == "pget" || name == "get1"
+}
+
 func (q Queue) MarshalText() ([]byte, error) {
 	var buf bytes.Buffer
 	escapeQuotes := func(s string) {
@@ -122,19 +160,47 @@ func (q Queue) MarshalText() ([]byte, error) {
 			prev = c
 		}
 	}
+	settings := make([]string, 0, len(q.LftpSettings))
+	for k := range q.LftpSettings {
+		settings = append(settings, k)
+	}
+	sort.Strings(settings)
+	for _, k := range settings {
+		buf.WriteString("set ")
+		buf.WriteString(k)
+		buf.WriteString(" '")
+		escapeQuotes(q.LftpSettings[k])
+		buf.WriteString("'\n")
+	}
+	if limit := q.rateLimit(); limit > 0 {
+		buf.WriteString(fmt.Sprintf("set net:limit-total-rate %d\n", limit))
+	}
+	for _, line := range q.Preamble {
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
 	buf.WriteString("open ")
 	buf.WriteString(q.Site.Name)
 	buf.WriteString("\n")
 	for _, item := range q.Transferable() {
+		cmd := q.getCmd(item)
 		buf.WriteString("queue ")
-		buf.WriteString(q.Site.GetCmd)
+		buf.WriteString(cmd)
 		buf.WriteString(" '")
 		escapeQuotes(item.RemotePath)
-		buf.WriteString("' '")
+		if outputFlag(cmd) {
+			buf.WriteString("' -o '")
+		} else {
+			buf.WriteString("' '")
+		}
 		escapeQuotes(item.LocalPath)
 		buf.WriteString("'\n")
 	}
 	buf.WriteString("queue start\nwait\n")
+	for _, line := range q.Epilogue {
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
 	return buf.Bytes(), nil
 }
 
@@ -159,12 +225,59 @@ func (q *Queue) tempFile() (string, error) {
 }
 
 func (q *Queue) rank(item *Item) int {
+	// Preferred groups only decide between items whose priorities rank equally
+	groups := len(q.PreferredGroups) + 1
+	rank := 0
 	for i, p := range q.priorities {
-		if p.MatchString(filepath.Base(item.RemotePath)) {
-			return len(q.priorities) - i
+		if item.match(p) {
+			rank = (len(q.priorities) - i) * groups
+			break
+		}
+	}
+	if i, ok := indexFold(q.PreferredGroups, item.Media.Group); ok {
+		rank += len(q.PreferredGroups) - i
+	}
+	return rank
+}
+
+func (q *Queue) ranked() bool {
+	return len(q.priorities) > 0 || len(q.PreferredGroups) > 0 || len(q.Scores) > 0
+}
+
+func (q *Queue) score(item *Item) {
+	item.Score = 0
+	item.ScoreDetails = nil
+	for _, s := range q.Scores {
+		if s.match(item) {
+			item.Score += s.Score
+			item.ScoreDetails = append(item.ScoreDetails, fmt.Sprintf("%s=%+d", s.Rule, s.Score))
 		}
 	}
-	return 0
+}
+
+func (q *Queue) compare(a, b *Item) int {
+	if rankA, rankB := q.rank(a), q.rank(b); rankA != rankB {
+		return rankA - rankB
+	}
+	return a.Score - b.Score
+}
+
+func (q *Queue) duplicate(item *Item, of *Item) {
+	item.Duplicate = true
+	if len(q.Scores) > 0 {
+		item.reject(fmt.Sprintf("DuplicateOf=%s Rank=%d Score=%d", of.RemotePath, q.rank(item), item.Score))
+	} else {
+		item.reject(fmt.Sprintf("DuplicateOf=%s Rank=%d", of.RemotePath, q.rank(item)))
+	}
+}
+
+// equal returns whether a and b are duplicates. When items are ranked by priorities or scores, different qualities of
+// the same media are duplicates, so that ranking decides between them.
+func (q *Queue) equal(a, b *parser.Media) bool {
+	if len(q.priorities) > 0 || len(q.Scores) > 0 {
+		return a.EqualContent(*b)
+	}
+	return a.Equal(*b)
 }
 
 func (q *Queue) deduplicate() {
@@ -179,64 +292,163 @@ func (q *Queue) deduplicate() {
 			if a.RemotePath == b.RemotePath {
 				continue
 			}
-			if a.Transfer && b.Transfer && a.Media.Equal(b.Media) {
-				if (a.Merged || b.Merged) && q.rank(a) == q.rank(b) {
+			if a.Transfer && b.Transfer && q.equal(&a.Media, &b.Media) {
+				c := q.compare(a, b)
+				// A newer revision from the same group always replaces an older one with equal rank
+				if c == 0 {
+					if a.supersedes(b) {
+						b.supersede(a, q.DeleteSuperseded)
+						continue
+					} else if b.supersedes(a) {
+						a.supersede(b, q.DeleteSuperseded)
+						continue
+					}
+				}
+				if !q.ranked() || (a.Merged || b.Merged) && c == 0 {
 					continue
 				}
-				if q.rank(a) <= q.rank(b) {
-					a.Duplicate = true
-					a.reject(fmt.Sprintf("DuplicateOf=%s Rank=%d", b.RemotePath, q.rank(a)))
+				if c <= 0 {
+					q.duplicate(a, b)
 				} else {
-					b.Duplicate = true
-					b.reject(fmt.Sprintf("DuplicateOf=%s Rank=%d", a.RemotePath, q.rank(b)))
+					q.duplicate(b, a)
 				}
 			}
 		}
 	}
 }
 
+func (q *Queue) applyCutoff() {
+	if q.Cutoff.pattern == nil {
+		return
+	}
+	// Reject candidates for media that already exists on disk in a quality meeting the cutoff. A newer revision of the
+	// on-disk item is exempt, as it supersedes that item during deduplication.
+	for i := range q.Items {
+		merged := &q.Items[i]
+		if !merged.Merged || !merged.Transfer || !q.Cutoff.match(merged) {
+			continue
+		}
+		for j := range q.Items {
+			item := &q.Items[j]
+			if item.Merged || !item.Transfer || !q.equal(&item.Media, &merged.Media) || item.supersedes(merged) {
+				continue
+			}
+			item.reject(fmt.Sprintf("Cutoff=%s MetBy=%s", q.Cutoff, merged.RemotePath))
+		}
+	}
+}
+
 func (q *Queue) merge(readDir readDir) {
 	// Merge on-disk duplicates into the queue so that they can be considered for deduplication
 	for _, i := range q.Transferable() {
-		q.Items = append(q.Items, i.duplicates(readDir)...)
+		q.Items = append(q.Items, i.duplicates(readDir, q.equal)...)
 	}
 }
 
-func matchAny(patterns []*regexp.Regexp, f os.FileInfo) (string, bool) {
+// unmerge removes on-disk duplicates that were merged only for the rejected items, i.e. those that no longer have any
+// transferable remote item of the same media.
+func (q *Queue) unmerge(items []Item, rejected []int) []Item {
+	var kept []Item
+	for _, item := range items {
+		if item.Merged && q.orphaned(items, rejected, &item) {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+func (q *Queue) orphaned(items []Item, rejected []int, merged *Item) bool {
+	for _, item := range items {
+		if !item.Merged && item.Transfer && q.equal(&item.Media, &merged.Media) {
+			return false
+		}
+	}
+	for _, i := range rejected {
+		if q.equal(&items[i].Media, &merged.Media) {
+			return true
+		}
+	}
+	return false
+}
+
+func indexFold(values []string, s string) (int, bool) {
+	if s == "" {
+		return -1, false
+	}
+	for i, v := range values {
+		if strings.EqualFold(v, s) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func matchAny(patterns []*regexp.Regexp, item *Item) (string, bool) {
 	for _, p := range patterns {
-		if p.MatchString(filepath.Base(f.Name())) {
+		if item.match(p) {
 			return p.String(), true
 		}
 	}
 	return "", false
 }
 
-func newQueue(site Site, files []os.FileInfo, readDir readDir) Queue {
-	q := Queue{Site: site, Items: make([]Item, 0, len(files))}
+func newQueue(site Site, files []os.FileInfo, readDir readDir, lister Lister) Queue {
+	q := Queue{Site: site, Items: make([]Item, 0, len(files)), now: time.Now()}
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Name()
+	}
+	// Errors are reported for each item when parsing
+	q.localDir.Prefetch(names)
 	// Initial filtering
-	now := time.Now().Round(time.Second)
+	now := q.now.Round(time.Second)
 	for _, f := range files {
-		item, err := newItem(f.Name(), f.ModTime(), q.localDir)
+		item, err := newItem(f.Name(), q.segments(f.Name()), f.ModTime(), q.localDir)
+		item.Size = f.Size()
+		item.isFile = f.Mode().IsRegular()
 		if err != nil {
 			item.reject(err.Error())
 		} else if isSymlink := f.Mode()&os.ModeSymlink != 0; q.SkipSymlinks && isSymlink {
 			item.reject(fmt.Sprintf("IsSymlink=%t SkipSymlinks=%t", isSymlink, q.SkipSymlinks))
 		} else if q.SkipFiles && f.Mode().IsRegular() {
 			item.reject(fmt.Sprintf("IsFile=%t SkipFiles=%t", f.Mode().IsRegular(), q.SkipFiles))
-		} else if p, match := matchAny(q.filters, f); match {
+		} else if p, match := matchAny(q.filters, &item); match {
 			item.reject(fmt.Sprintf("Filter=%s", p))
+		} else if _, blocked := indexFold(q.BlockedGroups, item.Media.Group); blocked {
+			item.reject(fmt.Sprintf("BlockedGroup=%s", item.Media.Group))
 		} else if age := now.Sub(item.ModTime); q.maxAge != 0 && age > q.maxAge {
 			item.reject(fmt.Sprintf("Age=%s MaxAge=%s", age, q.maxAge))
-		} else if p, match := matchAny(q.patterns, f); match {
+		} else if item.Size > 0 && q.minSize > 0 && item.Size < q.minSize {
+			item.reject(fmt.Sprintf("Size=%s MinSize=%s", FormatSize(item.Size), q.MinSize))
+		} else if item.Size > 0 && q.maxSize > 0 && item.Size > q.maxSize {
+			item.reject(fmt.Sprintf("Size=%s MaxSize=%s", FormatSize(item.Size), q.MaxSize))
+		} else if p, match := matchAny(q.patterns, &item); match {
 			item.accept(fmt.Sprintf("Match=%s", p))
 		}
 		q.Items = append(q.Items, item)
 	}
 	if q.Merge {
 		q.merge(readDir)
+		q.applyCutoff()
 	}
 	sort.Slice(q.Items, func(i, j int) bool { return q.Items[i].RemotePath < q.Items[j].RemotePath })
-	if len(q.priorities) > 0 {
+	if len(q.Scores) > 0 {
+		for i := range q.Items {
+			q.score(&q.Items[i])
+		}
+	}
+	candidates := append([]Item(nil), q.Items...)
+	q.deduplicate()
+	// Only the items remaining after deduplication are inspected, as listing is expensive. If any of them are rejected,
+	// deduplication is done again without them, so that a duplicate can take their place.
+	inspected := make(map[string]bool)
+	for rejected := q.inspect(lister, inspected); len(rejected) > 0; rejected = q.inspect(lister, inspected) {
+		for _, i := range rejected {
+			candidates[i] = q.Items[i]
+		}
+		candidates = q.unmerge(candidates, rejected)
+		q.Items = append(q.Items[:0], candidates...)
 		q.deduplicate()
 	}
 	// Deduplication must happen before IsDstDir check. This is because items with a higher rank might have been
@@ -246,5 +458,7 @@ func newQueue(site Site, files []os.FileInfo, readDir readDir) Queue {
 			item.reject(fmt.Sprintf("IsDstDirEmpty=%t", false))
 		}
 	}
+	// Free space is applied last, so that only items that would otherwise be transferred use it
+	q.applyFreeSpace()
 	return q
 }
@@ -4,6 +4,7 @@ import (
 	"encoding"
 	"encoding/json"
 	"os"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
@@ -28,17 +29,18 @@ func newTestSite() Site {
 }
 
 func newTestQueue(s Site, files []os.FileInfo) Queue {
-	return newQueue(s, files, func(dirname string) ([]os.FileInfo, error) { return nil, nil })
+	return newQueue(s, files, func(dirname string) ([]os.FileInfo, error) { return nil, nil }, nil)
 }
 
 type file struct {
 	name    string
+	size    int64
 	modTime time.Time
 	mode    os.FileMode
 }
 
 func (f file) Name() string       { return f.name }
-func (f file) Size() int64        { return 0 }
+func (f file) Size() int64        { return f.size }
 func (f file) Mode() os.FileMode  { return f.mode }
 func (f file) ModTime() time.Time { return f.modTime }
 func (f file) IsDir() bool        { return f.Mode().IsDir() }
@@ -115,7 +117,7 @@ func TestNewQueue(t *testing.T) {
 		}
 		return nil, nil
 	}
-	q := newQueue(s, files, readDir)
+	q := newQueue(s, files, readDir, nil)
 	expected := []Item{
 		{localDir: q.localDir, RemotePath: files[0].Name(), Transfer: false, Reason: "IsSymlink=true SkipSymlinks=true"},
 		{localDir: q.localDir, RemotePath: files[1].Name(), Transfer: false, Reason: "Age=48h0m0s MaxAge=24h0m0s"},
@@ -201,6 +203,160 @@ func TestDeduplicateIgnoreSelf(t *testing.T) {
 	}
 }
 
+func TestDeduplicatePreferredGroups(t *testing.T) {
+	s := newTestSite()
+	s.priorities = []*regexp.Regexp{regexp.MustCompile(`\.1080p\.`)}
+	s.PreferredGroups = []string{"grp1", "GRP2"}
+	files := []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01.720p.HDTV-GRP1"},
+		file{name: "/remote/The.Wire.S01E01.720p.HDTV-GRP2"},
+		file{name: "/remote/The.Wire.S01E02.1080p.HDTV-GRP1"},
+		file{name: "/remote/The.Wire.S01E02.1080p.HDTV-GRP2"},
+		file{name: "/remote/The.Wire.S01E02.1080p.HDTV-GRP3"},
+		file{name: "/remote/The.Wire.S01E03.1080p.HDTV-GRP2"},
+		file{name: "/remote/The.Wire.S01E03.1080p.HDTV-GRP3"},
+	}
+	q := newTestQueue(s, files)
+	want := []string{
+		"/remote/The.Wire.S01E01.720p.HDTV-GRP1",
+		"/remote/The.Wire.S01E02.1080p.HDTV-GRP1",
+		"/remote/The.Wire.S01E03.1080p.HDTV-GRP2",
+	}
+	actual := q.Transferable()
+	if len(want) != len(actual) {
+		t.Fatalf("Expected length %d, got %d", len(want), len(actual))
+	}
+	for i := range actual {
+		if actual[i].RemotePath != want[i] {
+			t.Errorf("Expected %s, got %s", want[i], actual[i].RemotePath)
+		}
+	}
+}
+
+func TestDeduplicateScores(t *testing.T) {
+	s := newTestSite()
+	s.Scores = []Score{
+		{Rule: Rule{Pattern: `\.WEB-DL\.`, pattern: regexp.MustCompile(`\.WEB-DL\.`)}, Score: 5},
+		{Rule: Rule{Pattern: `\.x265`, pattern: regexp.MustCompile(`\.x265`)}, Score: -10},
+		{Rule: Rule{Field: "Group", Pattern: "^GRP1$", pattern: regexp.MustCompile("^GRP1$")}, Score: 2},
+	}
+	files := []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01.1080p.HDTV.x264-GRP1"},
+		file{name: "/remote/The.Wire.S01E01.1080p.WEB-DL.x264-GRP2"},
+		file{name: "/remote/The.Wire.S01E02.1080p.WEB-DL.x265-GRP1"},
+		file{name: "/remote/The.Wire.S01E02.1080p.WEB-DL.x265-GRP2"},
+	}
+	q := newTestQueue(s, files)
+	var tests = []struct {
+		transfer bool
+		score    int
+		details  []string
+	}{
+		{false, 2, []string{"Group:^GRP1$=+2"}},
+		{true, 5, []string{`\.WEB-DL\.=+5`}},
+		{true, -3, []string{`\.WEB-DL\.=+5`, `\.x265=-10`, "Group:^GRP1$=+2"}},
+		{false, -5, []string{`\.WEB-DL\.=+5`, `\.x265=-10`}},
+	}
+	for i, tt := range tests {
+		item := q.Items[i]
+		if item.Transfer != tt.transfer {
+			t.Errorf("Expected Transfer=%t for Path=%q, got %t", tt.transfer, item.RemotePath, item.Transfer)
+		}
+		if item.Score != tt.score {
+			t.Errorf("Expected Score=%d for Path=%q, got %d", tt.score, item.RemotePath, item.Score)
+		}
+		if !reflect.DeepEqual(item.ScoreDetails, tt.details) {
+			t.Errorf("Expected ScoreDetails=%q for Path=%q, got %q", tt.details, item.RemotePath, item.ScoreDetails)
+		}
+	}
+	if want := "DuplicateOf=/remote/The.Wire.S01E01.1080p.WEB-DL.x264-GRP2 Rank=0 Score=2"; q.Items[0].Reason != want {
+		t.Errorf("Expected %q, got %q", want, q.Items[0].Reason)
+	}
+}
+
+func TestDeduplicateScoresAcrossQuality(t *testing.T) {
+	s := newTestSite()
+	scores, err := compileScores([]Score{
+		{Rule: Rule{Field: "Resolution", Pattern: "^1080p$"}, Score: 10},
+		{Rule: Rule{Pattern: `\.WEB-DL\.`}, Score: 5},
+		{Rule: Rule{Field: "Codec", Pattern: "^x265$"}, Score: -10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Scores = scores
+	q := newTestQueue(s, []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01.1080p.HDTV.x264-GRP"},
+		file{name: "/remote/The.Wire.S01E01.1080p.WEB-DL.x265-GRP"},
+		file{name: "/remote/The.Wire.S01E01.720p.WEB-DL.x264-GRP"},
+		file{name: "/remote/The.Wire.S01E02.720p.WEB-DL.x264-GRP"},
+	})
+	want := []string{"/remote/The.Wire.S01E01.1080p.HDTV.x264-GRP", "/remote/The.Wire.S01E02.720p.WEB-DL.x264-GRP"}
+	var got []string
+	for _, item := range q.Transferable() {
+		got = append(got, item.RemotePath)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+
+	// Without ranking, different qualities are not duplicates
+	s.Scores = nil
+	q = newTestQueue(s, []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01.1080p.HDTV.x264-GRP"},
+		file{name: "/remote/The.Wire.S01E01.720p.WEB-DL.x264-GRP"},
+	})
+	if n := len(q.Transferable()); n != 2 {
+		t.Errorf("want 2 transferable items, got %d", n)
+	}
+}
+
+func TestDeduplicateExtra(t *testing.T) {
+	cfg := Config{
+		Parsers: []Parser{{
+			Name:     "daily",
+			Patterns: []string{`^(?P<name>.+?)\.(?P<year>\d{4})\.(?P<month>\d{2})\.(?P<day>\d{2})\.`},
+		}},
+		LocalDirs: []LocalDir{{Name: "d1", Parser: "daily", Dir: "/tv/{{ .Name }}/"}},
+	}
+	if err := cfg.load(); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestSite()
+	s.localDir = cfg.LocalDirs[0]
+	s.priorities = []*regexp.Regexp{regexp.MustCompile(`\.1080p\.`)}
+	q := newTestQueue(s, []os.FileInfo{
+		file{name: "/remote/Show.2019.03.14.720p.WEB-GRP"},
+		file{name: "/remote/Show.2019.03.15.1080p.WEB-GRP"},
+		file{name: "/remote/Show.2019.03.15.720p.WEB-GRP"},
+	})
+	// Releases for different dates are different media
+	want := []string{"/remote/Show.2019.03.14.720p.WEB-GRP", "/remote/Show.2019.03.15.1080p.WEB-GRP"}
+	var got []string
+	for _, item := range q.Transferable() {
+		got = append(got, item.RemotePath)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestNewQueueBlockedGroups(t *testing.T) {
+	s := newTestSite()
+	s.BlockedGroups = []string{"grp2"}
+	q := newTestQueue(s, []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01.720p.HDTV-GRP1"},
+		file{name: "/remote/The.Wire.S01E02.720p.HDTV-GRP2"},
+	})
+	if !q.Items[0].Transfer {
+		t.Errorf("Expected Transfer=true for Path=%q", q.Items[0].RemotePath)
+	}
+	if want := "BlockedGroup=GRP2"; q.Items[1].Transfer || q.Items[1].Reason != want {
+		t.Errorf("Expected Transfer=false Reason=%s, got Transfer=%t Reason=%s", want, q.Items[1].Transfer,
+			q.Items[1].Reason)
+	}
+}
+
 func TestMergePreferringRemoteCopy(t *testing.T) {
 	s := newTestSite()
 	s.Merge = true
@@ -211,7 +367,7 @@ func TestMergePreferringRemoteCopy(t *testing.T) {
 			file{name: "The.Wire.S01E01.720p.BluRay.baz"},
 		}, nil
 	}
-	q := newQueue(s, []os.FileInfo{file{name: "/remote/The.Wire.S01E01.720p.BluRay.foo"}}, readDir)
+	q := newQueue(s, []os.FileInfo{file{name: "/remote/The.Wire.S01E01.720p.BluRay.foo"}}, readDir, nil)
 	if l := len(q.Items); l != 3 {
 		t.Fatalf("Expected length 3, got %d", l)
 	}
@@ -235,7 +391,7 @@ func TestMergePreferringLocalCopy(t *testing.T) {
 			file{name: "The.Wire.S01E02.720p.BluRay.baz"},
 		}, nil
 	}
-	q := newQueue(s, []os.FileInfo{file{name: "/remote/The.Wire.S01E01.720p.BluRay.foo"}}, readDir)
+	q := newQueue(s, []os.FileInfo{file{name: "/remote/The.Wire.S01E01.720p.BluRay.foo"}}, readDir, nil)
 	if l := len(q.Items); l != 2 {
 		t.Fatalf("Expected length 2, got %d", l)
 	}
@@ -264,7 +420,7 @@ func TestLocalCopyDoesNotDuplicateRemoteWithEqualRank(t *testing.T) {
 	q := newQueue(s, []os.FileInfo{
 		file{name: "/remote/The.Wire.S01E01.720p.BluRay.foo"},
 		file{name: "/remote/The.Wire.S01E01.720p.BluRay.bar"},
-	}, readDir)
+	}, readDir, nil)
 	if item := q.Items[0]; item.Transfer || item.Duplicate || !item.Merged {
 		t.Errorf("Expected Transfer=false Duplicate=false Merged=true for Path=%q", item.RemotePath)
 	}
@@ -275,6 +431,120 @@ func TestLocalCopyDoesNotDuplicateRemoteWithEqualRank(t *testing.T) {
 	}
 }
 
+func TestMergeSupersededByRevision(t *testing.T) {
+	s := newTestSite()
+	s.Merge = true
+	s.DeleteSuperseded = true
+	readDir := func(dirname string) ([]os.FileInfo, error) {
+		return []os.FileInfo{
+			file{name: "The.Wire.S01E01.720p.BluRay-GRP1"},
+			file{name: "The.Wire.S01E01.720p.BluRay-GRP2"},
+		}, nil
+	}
+	q := newQueue(s, []os.FileInfo{file{name: "/remote/The.Wire.S01E01.PROPER.720p.BluRay-GRP1"}}, readDir, nil)
+	if l := len(q.Items); l != 3 {
+		t.Fatalf("Expected length 3, got %d", l)
+	}
+	var tests = []struct {
+		item      Item
+		transfer  bool
+		duplicate bool
+		delete    bool
+	}{
+		{q.Items[0], false, true, true},  // Superseded by PROPER from the same group
+		{q.Items[1], true, false, false}, // Different group
+		{q.Items[2], true, false, false}, // Remote PROPER
+	}
+	for _, tt := range tests {
+		if tt.item.Transfer != tt.transfer || tt.item.Duplicate != tt.duplicate || tt.item.Delete != tt.delete {
+			t.Errorf("Expected Transfer=%t Duplicate=%t Delete=%t for Path=%q, got %+v",
+				tt.transfer, tt.duplicate, tt.delete, tt.item.RemotePath, tt.item)
+		}
+	}
+	if want := "SupersededBy=/remote/The.Wire.S01E01.PROPER.720p.BluRay-GRP1 Revision=0"; q.Items[0].Reason != want {
+		t.Errorf("Expected %q, got %q", want, q.Items[0].Reason)
+	}
+}
+
+func TestMergeWithCutoffAndRevision(t *testing.T) {
+	s := newTestSite()
+	s.Merge = true
+	s.DeleteSuperseded = true
+	s.Cutoff = Rule{Pattern: `\.BluRay\.`, pattern: regexp.MustCompile(`\.BluRay\.`)}
+	readDir := func(dirname string) ([]os.FileInfo, error) {
+		return []os.FileInfo{file{name: "The.Wire.S01E01.720p.BluRay.x264-GRP1"}}, nil
+	}
+	q := newQueue(s, []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01.PROPER.720p.BluRay.x264-GRP1"},
+		file{name: "/remote/The.Wire.S01E01.720p.BluRay.x264-GRP2"},
+	}, readDir, nil)
+	var tests = []struct {
+		path     string
+		transfer bool
+		delete   bool
+		reason   string
+	}{
+		{"/local/The.Wire/S1/The.Wire.S01E01.720p.BluRay.x264-GRP1", false, true,
+			"SupersededBy=/remote/The.Wire.S01E01.PROPER.720p.BluRay.x264-GRP1 Revision=0"},
+		{"/remote/The.Wire.S01E01.PROPER.720p.BluRay.x264-GRP1", true, false, "Match=.*"},
+		{"/remote/The.Wire.S01E01.720p.BluRay.x264-GRP2", false, false,
+			`Cutoff=\.BluRay\. MetBy=/local/The.Wire/S1/The.Wire.S01E01.720p.BluRay.x264-GRP1`},
+	}
+	for _, tt := range tests {
+		found := false
+		for _, item := range q.Items {
+			if item.RemotePath != tt.path {
+				continue
+			}
+			found = true
+			if item.Transfer != tt.transfer || item.Delete != tt.delete || item.Reason != tt.reason {
+				t.Errorf("Expected Transfer=%t Delete=%t Reason=%s for Path=%q, got Transfer=%t Delete=%t Reason=%s",
+					tt.transfer, tt.delete, tt.reason, tt.path, item.Transfer, item.Delete, item.Reason)
+			}
+		}
+		if !found {
+			t.Errorf("Expected item with Path=%q", tt.path)
+		}
+	}
+}
+
+func TestMergeWithCutoff(t *testing.T) {
+	s := newTestSite()
+	s.Merge = true
+	s.priorities = []*regexp.Regexp{regexp.MustCompile(`\.BluRay\.`), regexp.MustCompile(`\.WEB-DL\.`)}
+	s.Cutoff = Rule{Pattern: `\.(BluRay|WEB-DL)\.`, pattern: regexp.MustCompile(`\.(BluRay|WEB-DL)\.`)}
+	readDir := func(dirname string) ([]os.FileInfo, error) {
+		return []os.FileInfo{
+			file{name: "The.Wire.S01E01.1080p.WEB-DL.x264-GRP"},
+			file{name: "The.Wire.S01E02.1080p.HDTV.x264-GRP"},
+		}, nil
+	}
+	q := newQueue(s, []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01.1080p.BluRay.x264-GRP"},
+		file{name: "/remote/The.Wire.S01E02.1080p.BluRay.x264-GRP"},
+	}, readDir, nil)
+	var tests = []struct {
+		path     string
+		transfer bool
+		reason   string
+	}{
+		{"/remote/The.Wire.S01E01.1080p.BluRay.x264-GRP", false,
+			`Cutoff=\.(BluRay|WEB-DL)\. MetBy=/local/The.Wire/S1/The.Wire.S01E01.1080p.WEB-DL.x264-GRP`},
+		{"/remote/The.Wire.S01E02.1080p.BluRay.x264-GRP", true, `Match=.*`},
+	}
+	for _, tt := range tests {
+		for _, item := range q.Items {
+			if item.RemotePath != tt.path {
+				continue
+			}
+			if item.Transfer != tt.transfer || item.Reason != tt.reason {
+				t.Errorf("Expected Transfer=%t Reason=%s for Path=%q, got Transfer=%t Reason=%s",
+					tt.transfer, tt.reason, tt.path, item.Transfer, item.Reason)
+			}
+		}
+	}
+}
+
 func TestLocalCopyWithTooOldReplacement(t *testing.T) {
 	now := time.Now().Round(time.Second)
 	s := newTestSite()
@@ -288,7 +558,7 @@ func TestLocalCopyWithTooOldReplacement(t *testing.T) {
 		file{name: "/remote/The.Wire.S01E01.HDTV.foo", modTime: now.Add(-time.Duration(48) * time.Hour)},
 		file{name: "/remote/The.Wire.S01E01.WEBRip.foo", modTime: now},
 	}
-	q := newQueue(s, files, readDir)
+	q := newQueue(s, files, readDir, nil)
 	for _, item := range q.Transferable() {
 		t.Errorf("Expected empty queue, got %s", item.RemotePath)
 	}
@@ -383,6 +653,63 @@ wait
 	}
 }
 
+func TestMarshalTextGetFileCmd(t *testing.T) {
+	s := Site{
+		GetCmd:     "mirror",
+		GetFileCmd: "pget -n 4",
+		Name:       "siteA",
+	}
+	items := []Item{
+		{RemotePath: "/remote/foo", LocalPath: "/local/foo", Transfer: true},
+		{RemotePath: "/remote/bar's.mkv", LocalPath: "/local/bar's.mkv", Transfer: true, isFile: true},
+	}
+	q := Queue{Site: s, Items: items}
+	out, err := q.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `open siteA
+queue mirror '/remote/foo' '/local/foo'
+queue pget -n 4 '/remote/bar\'s.mkv' -o '/local/bar\'s.mkv'
+queue start
+wait
+`
+	if script := string(out); script != expected {
+		t.Fatalf("Expected %q, got %q", expected, script)
+	}
+}
+
+func TestMarshalTextScript(t *testing.T) {
+	s := Site{
+		GetCmd:       "mirror",
+		Name:         "siteA",
+		LftpSettings: map[string]string{"ssl:verify-certificate": "no", "ftp:passive-mode": "on", "ftp:ssl-auth/siteA": "TLS 1.2"},
+		Preamble:     []string{"debug 3"},
+		Epilogue:     []string{"echo done"},
+		rateLimit:    1000,
+	}
+	items := []Item{{RemotePath: "/remote/foo", LocalPath: "/local", Transfer: true}}
+	q := Queue{Site: s, Items: items}
+	out, err := q.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `set ftp:passive-mode 'on'
+set ftp:ssl-auth/siteA 'TLS 1.2'
+set ssl:verify-certificate 'no'
+set net:limit-total-rate 1000
+debug 3
+open siteA
+queue mirror '/remote/foo' '/local'
+queue start
+wait
+echo done
+`
+	if script := string(out); script != expected {
+		t.Fatalf("Expected %q, got %q", expected, script)
+	}
+}
+
 func TestMarshalJSON(t *testing.T) {
 	s := newTestSite()
 	var q json.Marshaler = newTestQueue(s, []os.FileInfo{file{name: "/remote/The.Wire.S01E01"}})
@@ -395,6 +722,7 @@ func TestMarshalJSON(t *testing.T) {
     "RemotePath": "/remote/The.Wire.S01E01",
     "LocalPath": "/local/The.Wire/S1/The.Wire.S01E01",
     "ModTime": "0001-01-01T00:00:00Z",
+    "Size": 0,
     "Transfer": true,
     "Reason": "Match=.*",
     "Media": {
@@ -404,13 +732,94 @@ func TestMarshalJSON(t *testing.T) {
       "Season": 1,
       "Episode": 1,
       "Resolution": "",
-      "Codec": ""
+      "Codec": "",
+      "Revision": 0,
+      "Group": "",
+      "Artist": "",
+      "Album": "",
+      "Format": "",
+      "Source": "",
+      "Edition": "",
+      "Extra": null,
+      "Segments": null
     },
     "Duplicate": false,
-    "Merged": false
+    "Merged": false,
+    "Delete": false,
+    "Score": 0,
+    "ScoreDetails": null,
+    "Verified": false,
+    "VerifyError": "",
+    "Extracted": null,
+    "ExtractError": ""
   }
 ]`
 	if got := string(out); got != want {
 		t.Errorf("want %q, got %q", want, got)
 	}
 }
+
+func TestNewQueueSize(t *testing.T) {
+	s := newTestSite()
+	s.MinSize, s.minSize = "1MB", 1e6
+	s.MaxSize, s.maxSize = "1GB", 1e9
+	files := []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01", size: 1e3},
+		file{name: "/remote/The.Wire.S01E02", size: 1e8},
+		file{name: "/remote/The.Wire.S01E03", size: 1e10},
+		file{name: "/remote/The.Wire.S01E04"}, // Unknown size
+	}
+	q := newTestQueue(s, files)
+	var tests = []struct {
+		i      int
+		reason string
+	}{
+		{0, "Size=1000 B MinSize=1MB"},
+		{1, "Match=.*"},
+		{2, "Size=9.3 GiB MaxSize=1GB"},
+		{3, "Match=.*"},
+	}
+	for _, tt := range tests {
+		if got := q.Items[tt.i].Reason; got != tt.reason {
+			t.Errorf("want %q, got %q", tt.reason, got)
+		}
+	}
+	if want := int64(1e8); q.TransferSize() != want {
+		t.Errorf("want %d, got %d", want, q.TransferSize())
+	}
+}
+
+func TestGetCmd(t *testing.T) {
+	s := newTestSite()
+	s.GetDirCmd = "mirror --parallel=2"
+	s.GetFileCmd = "pget -n 4"
+	overrides, err := compileOverrides([]GetCmdOverride{{Rule: Rule{Pattern: `\.iso$`}, Command: "get"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.GetCmdOverrides = overrides
+	files := []os.FileInfo{
+		file{name: "/remote/The.Wire.S01E01", mode: os.ModeDir},
+		file{name: "/remote/The.Wire.S01E02.mkv"},
+		file{name: "/remote/The.Wire.S01E03.iso"},
+		file{name: "/remote/The.Wire.S01E04", mode: os.ModeSymlink},
+	}
+	q := newTestQueue(s, files)
+	want := []string{"mirror --parallel=2", "pget -n 4", "get", "mirror --parallel=2"}
+	for i, w := range want {
+		if got := q.getCmd(&q.Items[i]); got != w {
+			t.Errorf("getCmd(%q) = %q, want %q", q.Items[i].RemotePath, got, w)
+		}
+	}
+
+	// Falls back to GetCmd
+	s.GetDirCmd = ""
+	s.GetCmdOverrides = nil
+	q = newTestQueue(s, files)
+	if got, want := q.getCmd(&q.Items[0]), "mirror"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+	if _, err := compileOverrides([]GetCmdOverride{{Rule: Rule{Pattern: ".*"}}}); err == nil {
+		t.Error("want error for empty command")
+	}
+}
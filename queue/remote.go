@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultMaxDepth = 3
+
+type listDir func(dirname string) ([]os.FileInfo, error)
+
+func isGlob(s string) bool { return strings.ContainsAny(s, `*?[\`) || strings.Contains(s, "{{") }
+
+// splitGlob splits dir into its static root and the remaining segments, starting with the first segment containing a
+// glob or template
+func splitGlob(dir string) (string, []string) {
+	parts := strings.Split(strings.Trim(path.Clean(dir), "/"), "/")
+	i := 0
+	for i < len(parts) && !isGlob(parts[i]) {
+		i++
+	}
+	root := strings.Join(parts[:i], "/")
+	if strings.HasPrefix(dir, "/") {
+		root = "/" + root
+	}
+	if i == len(parts) {
+		return root, nil
+	}
+	return root, parts[i:]
+}
+
+func validateDir(dir string) error {
+	_, segments := splitGlob(dir)
+	for i, s := range segments {
+		if s == "**" {
+			if i != len(segments)-1 {
+				return fmt.Errorf("invalid dir: %q: ** must be the last segment", dir)
+			}
+			continue
+		}
+		if _, err := path.Match(s, ""); err != nil {
+			return fmt.Errorf("invalid dir: %q: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+func expandDir(dir string, t time.Time) (string, error) {
+	funcs := template.FuncMap{"now": func() time.Time { return t }}
+	tmpl, err := template.New("").Funcs(templateFuncs).Funcs(funcs).Parse(dir)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, nil); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// RemoteDirs returns the remote dirs of this site, relative to time now. Dirs containing a template are evaluated once
+// for now and once for each of the preceding DaysBack days.
+func (s *Site) RemoteDirs(now time.Time) ([]string, error) {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, dir := range s.Dirs {
+		if !strings.Contains(dir, "{{") {
+			dirs = append(dirs, dir)
+			continue
+		}
+		for i := 0; i <= s.DaysBack; i++ {
+			d, err := expandDir(dir, now.AddDate(0, 0, -i))
+			if err != nil {
+				return nil, err
+			}
+			if !seen[d] {
+				dirs = append(dirs, d)
+				seen[d] = true
+			}
+		}
+	}
+	return dirs, nil
+}
+
+func (s *Site) maxDepth() int {
+	if s.MaxDepth == 0 {
+		return defaultMaxDepth
+	}
+	return s.MaxDepth
+}
+
+// List lists the remote directory dir using list. Segments of dir may contain globs, e.g. /tv/*/, in which case every
+// matching directory is listed. A final ** segment lists directories recursively, descending into directories that
+// cannot be parsed as media, up to MaxDepth levels. When listing a subdirectory fails, the remaining directories are
+// still listed and the first error is returned along with the files.
+func (s *Site) List(dir string, list listDir) ([]os.FileInfo, error) {
+	root, segments := splitGlob(dir)
+	return s.list(root, segments, 0, list)
+}
+
+func (s *Site) list(dir string, segments []string, depth int, list listDir) ([]os.FileInfo, error) {
+	files, err := list(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return files, nil
+	}
+	var (
+		res      []os.FileInfo
+		firstErr error
+	)
+	for _, f := range files {
+		name := path.Base(f.Name())
+		isDir := f.IsDir() || f.Mode()&os.ModeSymlink != 0
+		var (
+			fs  []os.FileInfo
+			err error
+		)
+		if segments[0] == "**" {
+			if _, parseErr := s.localDir.Media(name); !isDir || parseErr == nil || depth >= s.maxDepth() {
+				res = append(res, f)
+				continue
+			}
+			fs, err = s.list(f.Name(), segments, depth+1, list)
+		} else {
+			if match, _ := path.Match(segments[0], name); !isDir || !match {
+				continue
+			}
+			fs, err = s.list(f.Name(), segments[1:], depth, list)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		res = append(res, fs...)
+	}
+	return res, firstErr
+}
+
+// segments returns the path segments between the root of the dir containing remotePath and remotePath itself
+func (s *Site) segments(remotePath string) []string {
+	var (
+		longest  string
+		segments []string
+	)
+	parent := path.Dir(remotePath)
+	for _, dir := range s.Dirs {
+		root, _ := splitGlob(dir)
+		var rel string
+		if parent == root {
+			rel = ""
+		} else if strings.HasPrefix(parent, strings.TrimSuffix(root, "/")+"/") {
+			rel = strings.TrimPrefix(parent, strings.TrimSuffix(root, "/")+"/")
+		} else {
+			continue
+		}
+		if len(root) < len(longest) {
+			continue
+		}
+		longest = root
+		segments = nil
+		if rel != "" {
+			segments = strings.Split(rel, "/")
+		}
+	}
+	return segments
+}
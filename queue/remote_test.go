@@ -0,0 +1,165 @@
+package queue
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func testListDir(tree map[string][]file) listDir {
+	return func(dirname string) ([]os.FileInfo, error) {
+		files, ok := tree[dirname]
+		if !ok {
+			return nil, fmt.Errorf("no such dir: %s", dirname)
+		}
+		res := make([]os.FileInfo, len(files))
+		for i, f := range files {
+			f.name = dirname + "/" + f.name
+			res[i] = f
+		}
+		return res, nil
+	}
+}
+
+func names(files []os.FileInfo) []string {
+	var res []string
+	for _, f := range files {
+		res = append(res, f.Name())
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestSiteList(t *testing.T) {
+	list := testListDir(map[string][]file{
+		"/tv": {
+			{name: "The.Wire", mode: os.ModeDir},
+			{name: "Fargo", mode: os.ModeSymlink},
+			{name: "README"},
+		},
+		"/tv/The.Wire": {{name: "The.Wire.S01E01", mode: os.ModeDir}},
+		"/tv/Fargo":    {{name: "Fargo.S01E01", mode: os.ModeDir}},
+		"/archive": {
+			{name: "2019", mode: os.ModeDir},
+			{name: "The.Wire.S02E01", mode: os.ModeDir},
+		},
+		"/archive/2019":      {{name: "0314", mode: os.ModeDir}},
+		"/archive/2019/0314": {{name: "The.Wire.S03E01", mode: os.ModeDir}, {name: "misc", mode: os.ModeDir}},
+	})
+	s := newTestSite()
+	var tests = []struct {
+		dir      string
+		maxDepth int
+		out      []string
+		err      bool
+	}{
+		{"/tv", 0, []string{"/tv/Fargo", "/tv/README", "/tv/The.Wire"}, false},
+		{"/tv/*/", 0, []string{"/tv/Fargo/Fargo.S01E01", "/tv/The.Wire/The.Wire.S01E01"}, false},
+		{"/tv/The*", 0, []string{"/tv/The.Wire/The.Wire.S01E01"}, false},
+		{"/archive/**", 0, []string{"/archive/2019/0314/The.Wire.S03E01", "/archive/The.Wire.S02E01"}, true}, // misc is not listable
+		{"/archive/**", 1, []string{"/archive/2019/0314", "/archive/The.Wire.S02E01"}, false},
+		{"/missing/*", 0, nil, true},
+	}
+	for _, tt := range tests {
+		s.MaxDepth = tt.maxDepth
+		files, err := s.List(tt.dir, list)
+		if (err != nil) != tt.err {
+			t.Errorf("List(%q) = %v, want error=%t", tt.dir, err, tt.err)
+		}
+		if got := names(files); !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("List(%q) = %q, want %q", tt.dir, got, tt.out)
+		}
+	}
+}
+
+func TestValidateDir(t *testing.T) {
+	var tests = []struct {
+		in    string
+		valid bool
+	}{
+		{"/tv", true},
+		{"/tv/*/", true},
+		{"/tv/**", true},
+		{"/tv/**/foo", false},
+		{"/tv/[", false},
+	}
+	for _, tt := range tests {
+		if err := validateDir(tt.in); (err == nil) != tt.valid {
+			t.Errorf("validateDir(%q) = %v, want valid=%t", tt.in, err, tt.valid)
+		}
+	}
+}
+
+func TestSegments(t *testing.T) {
+	s := Site{Dirs: []string{"/tv/*/", "/tv/archive/**", "/movies", `/incoming/{{ now | date "0102" }}/`}}
+	var tests = []struct {
+		in  string
+		out []string
+	}{
+		{"/tv/The.Wire/The.Wire.S01E01", []string{"The.Wire"}},
+		{"/tv/archive/2019/0314/The.Wire.S01E01", []string{"2019", "0314"}},
+		{"/movies/Heat.1995", nil},
+		{"/other/Heat.1995", nil},
+		{"/incoming/0314/Heat.1995", []string{"0314"}},
+	}
+	for _, tt := range tests {
+		if got := s.segments(tt.in); !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("segments(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestNewQueueSegments(t *testing.T) {
+	s := newTestSite()
+	s.Dirs = []string{"/tv/*/"}
+	s.patterns = []*regexp.Regexp{regexp.MustCompile("^The.Wire/")}
+	s.localDir.Template = template.Must(template.New("t").Parse(`/local/{{ index .Segments 0 }}/`))
+	files := []os.FileInfo{
+		file{name: "/tv/The.Wire/The.Wire.S01E01"},
+		file{name: "/tv/Fargo/The.Wire.S01E02"},
+	}
+	q := newTestQueue(s, files)
+	if got := len(q.Transferable()); got != 1 {
+		t.Fatalf("want 1 transferable item, got %d", got)
+	}
+	item := q.Transferable()[0]
+	if want := "/local/The.Wire/The.Wire.S01E01"; item.LocalPath != want {
+		t.Errorf("want %q, got %q", want, item.LocalPath)
+	}
+	if want := "Match=^The.Wire/"; item.Reason != want {
+		t.Errorf("want %q, got %q", want, item.Reason)
+	}
+}
+
+func TestRemoteDirs(t *testing.T) {
+	now := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		dirs     []string
+		daysBack int
+		out      []string
+	}{
+		{[]string{"/incoming", "/today/"}, 2, []string{"/incoming", "/today/"}},
+		{[]string{`/incoming/{{ now | date "0102" }}`}, 0, []string{"/incoming/0301"}},
+		{[]string{`/incoming/{{ now | dateFormat "0102" }}/`}, 2, []string{"/incoming/0301/", "/incoming/0228/", "/incoming/0227/"}},
+		{[]string{`/incoming/{{ now | date "2006-01" }}`}, 2, []string{"/incoming/2019-03", "/incoming/2019-02"}},
+	}
+	for _, tt := range tests {
+		s := Site{Dirs: tt.dirs, DaysBack: tt.daysBack}
+		got, err := s.RemoteDirs(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.out) {
+			t.Errorf("RemoteDirs(%q) = %q, want %q", tt.dirs, got, tt.out)
+		}
+	}
+	s := Site{Dirs: []string{`/incoming/{{ now | date }}`}}
+	if _, err := s.RemoteDirs(now); err == nil {
+		t.Error("want error")
+	}
+}
@@ -0,0 +1,162 @@
+package queue
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mpolden/lftpq/parser"
+	"golang.org/x/text/unicode/norm"
+)
+
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+type Sanitize struct {
+	Charset      string
+	Replacements []Replacement
+	MaxLength    int
+	Normalize    string
+}
+
+func (s *Sanitize) compile() error {
+	switch s.Charset {
+	case "", "posix", "windows":
+	default:
+		return fmt.Errorf("invalid charset: %q (must be %q or %q)", s.Charset, "posix", "windows")
+	}
+	switch s.Normalize {
+	case "", "NFC", "NFD":
+	default:
+		return fmt.Errorf("invalid normalization: %q (must be %q or %q)", s.Normalize, "NFC", "NFD")
+	}
+	if s.MaxLength < 0 {
+		return fmt.Errorf("invalid max length: %d", s.MaxLength)
+	}
+	replacements, err := compileReplacements(s.Replacements)
+	if err != nil {
+		return err
+	}
+	s.Replacements = replacements
+	return nil
+}
+
+func (s *Sanitize) component(name string) string {
+	for _, r := range s.Replacements {
+		name = r.pattern.ReplaceAllString(name, r.Replacement)
+	}
+	switch s.Normalize {
+	case "NFC":
+		name = norm.NFC.String(name)
+	case "NFD":
+		name = norm.NFD.String(name)
+	}
+	switch s.Charset {
+	case "posix":
+		name = strings.Map(func(r rune) rune {
+			if r == 0 || unicode.IsControl(r) {
+				return -1
+			}
+			return r
+		}, name)
+	case "windows":
+		name = strings.Map(func(r rune) rune {
+			if unicode.IsControl(r) || strings.ContainsRune(`<>:"\|?*`, r) {
+				return -1
+			}
+			return r
+		}, name)
+		// Windows silently strips trailing dots and spaces
+		name = strings.TrimRight(name, ". ")
+		base := name
+		if i := strings.IndexByte(base, '.'); i > -1 {
+			base = base[:i]
+		}
+		if windowsReserved[strings.ToUpper(base)] {
+			name = base + "_" + name[len(base):]
+		}
+	}
+	if s.MaxLength > 0 && len(name) > s.MaxLength {
+		name = truncate(name, s.MaxLength)
+	}
+	if name == "" && s.Charset != "" {
+		name = "_"
+	}
+	return name
+}
+
+// truncate shortens name to at most n bytes, without splitting runes. A short file extension, such as .mkv, is kept.
+func truncate(name string, n int) string {
+	ext := filepath.Ext(name)
+	if len(ext) > 5 || len(ext) >= n || strings.IndexFunc(ext, unicode.IsLetter) == -1 ||
+		strings.IndexFunc(ext[1:], isSeparator) > -1 {
+		ext = ""
+	}
+	s := name[:len(name)-len(ext)]
+	n -= len(ext)
+	for len(s) > n {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return s + ext
+}
+
+// templateRoot returns the directory of the static prefix of template, i.e. the deepest directory that is the same
+// for all media. This is the current directory for templates without a static directory.
+func templateRoot(tmpl string) string {
+	prefix := tmpl
+	if i := strings.Index(tmpl, "{{"); i > -1 {
+		prefix = tmpl[:i]
+	}
+	i := strings.LastIndex(prefix, string(filepath.Separator))
+	if i == -1 {
+		return "."
+	}
+	if i == 0 {
+		return string(filepath.Separator)
+	}
+	return prefix[:i]
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// rootDir returns the static directory of the template of this local dir, which every local path must be within
+func (d *LocalDir) rootDir() string {
+	if d.root != "" {
+		return d.root
+	}
+	return templateRoot(d.Template.Tree.Root.String())
+}
+
+// Path returns the local path of media m, sanitized according to the policy of this local dir
+func (d *LocalDir) Path(m parser.Media) (string, error) {
+	path, err := m.PathIn(d.Template)
+	if err != nil {
+		return "", err
+	}
+	root := d.rootDir()
+	prefix := ""
+	if root != "." && strings.HasPrefix(path, root) {
+		prefix = root
+	}
+	parts := strings.Split(path[len(prefix):], string(filepath.Separator))
+	for i, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		parts[i] = d.Sanitize.component(part)
+	}
+	path = filepath.Clean(prefix + strings.Join(parts, string(filepath.Separator)))
+	if !within(root, path) {
+		return "", fmt.Errorf("invalid local path: %q: outside %q", path, root)
+	}
+	return path, nil
+}
@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"regexp"
+	"testing"
+	"text/template"
+
+	"github.com/mpolden/lftpq/parser"
+)
+
+func TestSanitizeComponent(t *testing.T) {
+	var tests = []struct {
+		sanitize Sanitize
+		in       string
+		out      string
+	}{
+		{Sanitize{}, "What?: A Title", "What?: A Title"},
+		{Sanitize{Charset: "posix"}, "What?\x00\t", "What?"},
+		{Sanitize{Charset: "windows"}, `What?: A "Title"|*<>.. `, "What A Title"},
+		{Sanitize{Charset: "windows"}, "con", "con_"},
+		{Sanitize{Charset: "windows"}, "LPT1.txt", "LPT1_.txt"},
+		{Sanitize{Charset: "windows"}, "Conan", "Conan"},
+		{Sanitize{Charset: "windows"}, "???", "_"},
+		{Sanitize{Charset: "windows", Replacements: []Replacement{{pattern: regexp.MustCompile(":"), Replacement: " -"}}}, "Star Trek: TNG", "Star Trek - TNG"},
+		{Sanitize{MaxLength: 8}, "abcdefghijkl", "abcdefgh"},
+		{Sanitize{MaxLength: 8}, "abcdefghijkl.mkv", "abcd.mkv"},
+		{Sanitize{MaxLength: 8}, "Show.S01E01.720p-GRP", "Show.S01"},
+		{Sanitize{MaxLength: 6}, "Am\u00e9lie.2001", "Am\u00e9li"},
+		{Sanitize{Normalize: "NFC"}, "Ame\u0301lie", "Am\u00e9lie"},
+		{Sanitize{Normalize: "NFD"}, "Am\u00e9lie", "Ame\u0301lie"},
+		{Sanitize{Normalize: "NFC"}, "Vie\u0323\u0302t", "Vi\u1ec7t"},
+		{Sanitize{Normalize: "NFD"}, "Vi\u1ec7t", "Vie\u0323\u0302t"},
+		{Sanitize{Normalize: "NFC"}, "Vie\u0302\u0323t", "Vi\u1ec7t"},
+		{Sanitize{Normalize: "NFC"}, "\u1112\u1161\u11ab", "\ud55c"},
+		{Sanitize{Normalize: "NFD"}, "\ud55c", "\u1112\u1161\u11ab"},
+		{Sanitize{Normalize: "NFC"}, "\u30ab\u3099", "\u30ac"},
+	}
+	for _, tt := range tests {
+		if got := tt.sanitize.component(tt.in); got != tt.out {
+			t.Errorf("component(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestSanitizeCompile(t *testing.T) {
+	var tests = []struct {
+		sanitize Sanitize
+		valid    bool
+	}{
+		{Sanitize{}, true},
+		{Sanitize{Charset: "windows", Normalize: "NFC", MaxLength: 255}, true},
+		{Sanitize{Charset: "dos"}, false},
+		{Sanitize{Normalize: "NFKC"}, false},
+		{Sanitize{MaxLength: -1}, false},
+		{Sanitize{Replacements: []Replacement{{Pattern: "("}}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.sanitize.compile(); (err == nil) != tt.valid {
+			t.Errorf("compile(%+v) = %v, want valid=%t", tt.sanitize, err, tt.valid)
+		}
+	}
+}
+
+func TestTemplateRoot(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{"/media/tv/{{ .Name }}/", "/media/tv"},
+		{"/media/tv/S{{ .Season }}/", "/media/tv"},
+		{"/media/tv/", "/media/tv"},
+		{"/media/tv", "/media"},
+		{"/{{ .Name }}", "/"},
+		{"{{ .Name }}/", "."},
+	}
+	for _, tt := range tests {
+		if got := templateRoot(tt.in); got != tt.out {
+			t.Errorf("templateRoot(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestLocalDirPath(t *testing.T) {
+	d := LocalDir{
+		Template: template.Must(parseTemplate("/media/tv/{{ .Name }}/")),
+		Sanitize: Sanitize{Charset: "windows"},
+		root:     "/media/tv",
+	}
+	var tests = []struct {
+		name string
+		out  string
+		err  bool
+	}{
+		{"What?", "/media/tv/What/foo", false},
+		{"..", "", true},
+		{"../../etc", "", true},
+		{"a/../b", "/media/tv/b/foo", false},
+	}
+	for _, tt := range tests {
+		got, err := d.Path(parser.Media{Release: "foo", Name: tt.name})
+		if (err != nil) != tt.err {
+			t.Errorf("Path(%q) = %v, want error=%t", tt.name, err, tt.err)
+		}
+		if got != tt.out {
+			t.Errorf("Path(%q) = %q, want %q", tt.name, got, tt.out)
+		}
+	}
+}
+
+func TestLocalDirPathContainment(t *testing.T) {
+	var tests = []struct {
+		dir  string
+		name string
+		out  string
+		err  bool
+	}{
+		// Root is resolved from the template when not set when loading config
+		{"/media/tv/{{ .Name }}/", "../../etc", "", true},
+		{"/media/tv/{{ .Name }}/", "The.Wire", "/media/tv/The.Wire/foo", false},
+		// Templates without a static directory are relative to the current directory
+		{"{{ .Name }}/", "The.Wire", "The.Wire/foo", false},
+		{"{{ .Name }}/", "..", "", true},
+		{"{{ .Name }}/", "/etc", "", true},
+		{"{{ .Name }}", "..", "", true},
+	}
+	for _, tt := range tests {
+		d := LocalDir{Template: template.Must(parseTemplate(tt.dir))}
+		got, err := d.Path(parser.Media{Release: "foo", Name: tt.name})
+		if (err != nil) != tt.err {
+			t.Errorf("Path(%q) in %q = %v, want error=%t", tt.name, tt.dir, err, tt.err)
+		}
+		if got != tt.out {
+			t.Errorf("Path(%q) in %q = %q, want %q", tt.name, tt.dir, got, tt.out)
+		}
+	}
+}
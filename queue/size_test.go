@@ -0,0 +1,51 @@
+package queue
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out int64
+		err bool
+	}{
+		{"1024", 1024, false},
+		{"100B", 100, false},
+		{"700MB", 700e6, false},
+		{"700 MiB", 700 << 20, false},
+		{"700M", 700 << 20, false},
+		{"1.5GiB", 3 << 29, false},
+		{"2TB", 2e12, false},
+		{"", 0, true},
+		{"foo", 0, true},
+		{"-1GB", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("parseSize(%q) = %v, want error=%t", tt.in, err, tt.err)
+		}
+		if got != tt.out {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	var tests = []struct {
+		in  int64
+		out string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{3 << 29, "1.5 GiB"},
+		{5 << 40, "5.0 TiB"},
+		{1 << 50, "1.0 PiB"},
+		{1<<63 - 1, "8.0 EiB"},
+	}
+	for _, tt := range tests {
+		if got := FormatSize(tt.in); got != tt.out {
+			t.Errorf("FormatSize(%d) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
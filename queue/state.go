@@ -0,0 +1,165 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// State records the planned queues of a run, so that an interrupted run can be resumed with the same decisions. Items
+// are marked as done once their queue has been transferred and verified, not as each transfer finishes, so a run that is
+// interrupted during a transfer resumes every item of that queue.
+type State struct {
+	path   string
+	Queues []QueueState
+}
+
+type QueueState struct {
+	Site  string
+	Items []ItemState
+}
+
+type ItemState struct {
+	RemotePath string
+	LocalPath  string
+	IsFile     bool
+	Done       bool
+}
+
+func NewState(path string, queues []Queue) *State {
+	s := State{path: path}
+	for _, q := range queues {
+		qs := QueueState{Site: q.Site.Name}
+		for _, item := range q.Transferable() {
+			qs.Items = append(qs.Items, ItemState{RemotePath: item.RemotePath, LocalPath: item.LocalPath, IsFile: item.isFile})
+		}
+		s.Queues = append(s.Queues, qs)
+	}
+	return &s
+}
+
+func ReadState(path string) (*State, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := State{path: path}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid state: %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Save writes the state atomically, so that a crash while saving does not leave a truncated state behind
+func (s *State) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(s.path), ".lftpqstate")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+func (s *State) Remove() error { return os.Remove(s.path) }
+
+// Done marks the given items in the queue for site as done
+func (s *State) Done(site string, items []*Item) {
+	done := make(map[string]bool, len(items))
+	for _, item := range items {
+		done[item.RemotePath] = true
+	}
+	for i := range s.Queues {
+		if s.Queues[i].Site != site {
+			continue
+		}
+		for j := range s.Queues[i].Items {
+			if done[s.Queues[i].Items[j].RemotePath] {
+				s.Queues[i].Items[j].Done = true
+			}
+		}
+	}
+}
+
+// Merge adds the unfinished items of old that are not already planned in this state, so that starting a new run does
+// not discard what remains of an interrupted one
+func (s *State) Merge(old *State) {
+	for _, oq := range old.Queues {
+		i := -1
+		for j := range s.Queues {
+			if s.Queues[j].Site == oq.Site {
+				i = j
+				break
+			}
+		}
+		if i == -1 {
+			s.Queues = append(s.Queues, QueueState{Site: oq.Site})
+			i = len(s.Queues) - 1
+		}
+		planned := make(map[string]bool, len(s.Queues[i].Items))
+		for _, item := range s.Queues[i].Items {
+			planned[item.RemotePath] = true
+		}
+		for _, item := range oq.Items {
+			if !item.Done && !planned[item.RemotePath] {
+				s.Queues[i].Items = append(s.Queues[i].Items, item)
+			}
+		}
+		if len(s.Queues[i].Items) == 0 {
+			s.Queues = append(s.Queues[:i], s.Queues[i+1:]...)
+		}
+	}
+}
+
+// Completed returns whether all items in this state are done
+func (s *State) Completed() bool {
+	for _, q := range s.Queues {
+		for _, item := range q.Items {
+			if !item.Done {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Resume returns queues containing the unfinished items of this state
+func (s *State) Resume(sites []Site) ([]Queue, error) {
+	var qs []Queue
+	for _, state := range s.Queues {
+		site, err := lookupSite(state.Site, sites)
+		if err != nil {
+			return nil, err
+		}
+		q := Queue{Site: site, now: time.Now()}
+		for _, is := range state.Items {
+			if is.Done {
+				continue
+			}
+			item, err := newItem(is.RemotePath, site.segments(is.RemotePath), time.Time{}, site.localDir)
+			if err != nil {
+				item = Item{RemotePath: is.RemotePath}
+			}
+			// Keep the planned destination, even if config has changed since
+			item.LocalPath = is.LocalPath
+			item.isFile = is.IsFile
+			item.accept("Resume=true")
+			q.Items = append(q.Items, item)
+		}
+		qs = append(qs, q)
+	}
+	return qs, nil
+}
@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lftpq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state")
+
+	s1 := newTestSite()
+	s1.Name = "s1"
+	s2 := newTestSite()
+	s2.Name = "s2"
+	q1 := newTestQueue(s1, []os.FileInfo{file{name: "/remote/The.Wire.S01E01"}, file{name: "/remote/The.Wire.S01E02.mkv"}})
+	q2 := newTestQueue(s2, []os.FileInfo{file{name: "/remote/The.Wire.S02E01", mode: os.ModeDir}})
+	state := NewState(path, []Queue{q1, q2})
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+	state.Done("s1", q1.Transferable()[:1])
+	state.Done("s2", q1.Transferable()[1:]) // Items of another site are not marked
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = ReadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qs, err := state.Resume([]Site{s1, s2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(qs) != 2 {
+		t.Fatalf("want 2 queues, got %d", len(qs))
+	}
+	var paths []string
+	for _, q := range qs {
+		for _, item := range q.Transferable() {
+			paths = append(paths, item.RemotePath+" "+item.LocalPath+" "+item.Reason)
+		}
+	}
+	want := []string{
+		"/remote/The.Wire.S01E02.mkv /local/The.Wire/S1/The.Wire.S01E02.mkv Resume=true",
+		"/remote/The.Wire.S02E01 /local/The.Wire/S2/The.Wire.S02E01 Resume=true",
+	}
+	if !reflect.DeepEqual(want, paths) {
+		t.Errorf("want %q, got %q", want, paths)
+	}
+	if state.Completed() {
+		t.Error("want state to be incomplete")
+	}
+
+	// A new run keeps unfinished items of the old one
+	q3 := newTestQueue(s1, []os.FileInfo{file{name: "/remote/The.Wire.S01E03"}})
+	next := NewState(path, []Queue{q3})
+	next.Merge(state)
+	qs, err = next.Resume([]Site{s1, s2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths = nil
+	for _, item := range qs[0].Transferable() {
+		paths = append(paths, item.RemotePath+" "+item.LocalPath+" "+item.Reason)
+	}
+	want = []string{
+		"/remote/The.Wire.S01E03 /local/The.Wire/S1/The.Wire.S01E03 Resume=true",
+		"/remote/The.Wire.S01E02.mkv /local/The.Wire/S1/The.Wire.S01E02.mkv Resume=true",
+	}
+	if len(qs) != 2 || !reflect.DeepEqual(want, paths) {
+		t.Errorf("want %q in 2 queues, got %q in %d", want, paths, len(qs))
+	}
+
+	if _, err := state.Resume([]Site{s1}); err == nil {
+		t.Error("want error for unknown site")
+	}
+	if err := state.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadState(path); err == nil {
+		t.Error("want error for removed state")
+	}
+}
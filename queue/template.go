@@ -0,0 +1,172 @@
+package queue
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mpolden/lftpq/parser"
+)
+
+// sampleMedia is used to validate templates when loading config. All fields are set so that templates using any
+// variable can be executed.
+var sampleMedia = parser.Media{
+	Release:    "The.Wire.S01E01.720p.BluRay.x264-GRP",
+	Name:       "The.Wire",
+	Year:       2002,
+	Season:     1,
+	Episode:    1,
+	Resolution: "720p",
+	Codec:      "x264",
+	Group:      "GRP",
+	Artist:     "Daft.Punk",
+	Album:      "Discovery",
+	Format:     "FLAC",
+	Source:     "WEB",
+	Edition:    "Directors.Cut",
+	Extra:      map[string]string{},
+	Segments:   []string{"tv", "The.Wire", "S01"},
+}
+
+var templateFuncs = template.FuncMap{
+	"Sprintf":    fmt.Sprintf,
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"title":      title,
+	"replace":    replace,
+	"trim":       trim,
+	"first":      first,
+	"default":    defaultValue,
+	"pad":        pad,
+	"sanitize":   sanitize,
+	"dateFormat": dateFormat,
+	"date":       dateFormat,
+	"now":        time.Now,
+}
+
+func parseTemplate(tmpl string) (*template.Template, error) {
+	t, err := template.New("").Funcs(templateFuncs).Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func validateTemplate(t *template.Template) error {
+	m := sampleMedia
+	// Set every referenced key of Extra, as a missing key cannot be passed to template functions
+	m.Extra = make(map[string]string)
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree == nil {
+			continue
+		}
+		for _, key := range extraKeys(tmpl.Tree.Root) {
+			m.Extra[key] = "extra"
+		}
+	}
+	_, err := m.PathIn(t)
+	return err
+}
+
+// extraKeys returns the keys of Extra referenced as fields, e.g. .Extra.month or $.Extra.month, in the template tree
+// rooted at node.
+func extraKeys(node parse.Node) []string {
+	var keys []string
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Nodes {
+			keys = append(keys, extraKeys(c)...)
+		}
+	case *parse.ActionNode:
+		keys = extraKeys(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Cmds {
+			keys = append(keys, extraKeys(c)...)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			keys = append(keys, extraKeys(arg)...)
+		}
+	case *parse.FieldNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "Extra" {
+			keys = append(keys, n.Ident[1])
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 2 && n.Ident[0] == "$" && n.Ident[1] == "Extra" {
+			keys = append(keys, n.Ident[2])
+		}
+	case *parse.IfNode:
+		keys = extraKeys(&n.BranchNode)
+	case *parse.RangeNode:
+		keys = extraKeys(&n.BranchNode)
+	case *parse.WithNode:
+		keys = extraKeys(&n.BranchNode)
+	case *parse.BranchNode:
+		keys = append(keys, extraKeys(n.Pipe)...)
+		keys = append(keys, extraKeys(n.List)...)
+		keys = append(keys, extraKeys(n.ElseList)...)
+	case *parse.TemplateNode:
+		keys = extraKeys(n.Pipe)
+	}
+	return keys
+}
+
+func isSeparator(r rune) bool {
+	return r == '.' || r == '_' || r == '-' || unicode.IsSpace(r)
+}
+
+func title(s string) string {
+	var sb strings.Builder
+	prev := ' '
+	for _, r := range s {
+		if isSeparator(prev) {
+			r = unicode.ToUpper(r)
+		}
+		sb.WriteRune(r)
+		prev = r
+	}
+	return sb.String()
+}
+
+func replace(old, new, s string) string { return strings.ReplaceAll(s, old, new) }
+
+func trim(s string) string { return strings.TrimFunc(s, isSeparator) }
+
+func first(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return ""
+	}
+	return string(r)
+}
+
+func defaultValue(def, v interface{}) interface{} {
+	if v == nil || reflect.ValueOf(v).IsZero() {
+		return def
+	}
+	return v
+}
+
+func pad(width int, v interface{}) string { return fmt.Sprintf("%0*v", width, v) }
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func dateFormat(layout string, t time.Time) string { return t.Format(layout) }
@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/mpolden/lftpq/parser"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	m := parser.Media{Release: "foo", Name: "the.wire", Season: 1, Group: "", Year: 2002}
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{`/{{ .Name | lower }}`, "/the.wire"},
+		{`/{{ .Name | upper }}`, "/THE.WIRE"},
+		{`/{{ .Name | title }}`, "/The.Wire"},
+		{`/{{ .Name | replace "." " " }}`, "/the wire"},
+		{`/{{ "._the.wire-" | trim }}`, "/the.wire"},
+		{`/{{ .Name | first | upper }}/{{ .Name }}`, "/T/the.wire"},
+		{`/{{ .Group | default "none" }}`, "/none"},
+		{`/{{ .Year | default 1900 }}`, "/2002"},
+		{`/S{{ .Season | pad 2 }}`, "/S01"},
+		{`/{{ "AC/DC: Live?" | sanitize }}`, "/ACDC Live"},
+		{`/{{ now | dateFormat "2006" | len }}`, "/4"},
+		{`/S{{ .Season | Sprintf "%02d" }}`, "/S01"},
+	}
+	for _, tt := range tests {
+		tmpl, err := parseTemplate(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := m.PathIn(tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.out {
+			t.Errorf("PathIn(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	var tests = []struct {
+		in    string
+		valid bool
+	}{
+		{`/tv/{{ .Name | lower }}/`, true},
+		{`/tv/{{ .Extra.month }}/`, true},
+		{`/tv/{{ .Extra.month | upper }}/`, true},
+		{`/tv/{{ if .Extra.day }}{{ .Extra.day | pad 2 }}{{ end }}/`, true},
+		{`/tv/{{ $.Extra.month | lower }}/`, true},
+		{`/tv/{{ index .Extra "month" | upper }}/`, true},
+		{`/tv/{{ .Nam }}/`, false},
+		{`/tv/{{ .Name | pad "x" }}/`, false},
+	}
+	for _, tt := range tests {
+		tmpl, err := parseTemplate(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validateTemplate(tmpl); (err == nil) != tt.valid {
+			t.Errorf("validateTemplate(%q) = %v, want valid=%t", tt.in, err, tt.valid)
+		}
+	}
+}
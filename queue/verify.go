@@ -0,0 +1,206 @@
+package queue
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// checksum is an expected checksum of a file, as listed in a checksum file.
+type checksum struct {
+	path string
+	sum  string
+	hash func() hash.Hash
+}
+
+var checksumHashes = map[string]func() hash.Hash{
+	".sfv":    func() hash.Hash { return crc32.NewIEEE() },
+	".md5":    md5.New,
+	".sha1":   sha1.New,
+	".sha256": sha256.New,
+}
+
+// parseChecksums parses a checksum file. SFV files have lines on the form "<name> <crc32>", while other checksum files
+// use the format of md5sum and friends, i.e. "<sum>  <name>" or "<sum> *<name>". Lines starting with ";" or "#" are
+// comments. Names are relative to dir.
+func parseChecksums(r io.Reader, dir string, ext string) ([]checksum, error) {
+	newHash, ok := checksumHashes[ext]
+	if !ok {
+		return nil, fmt.Errorf("invalid checksum file type: %q", ext)
+	}
+	var sums []checksum
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var name, sum string
+		if ext == ".sfv" {
+			i := strings.LastIndexAny(line, " \t")
+			if i == -1 {
+				return nil, fmt.Errorf("invalid checksum line: %q", line)
+			}
+			name, sum = strings.TrimSpace(line[:i]), line[i+1:]
+		} else {
+			i := strings.IndexAny(line, " \t")
+			if i == -1 {
+				return nil, fmt.Errorf("invalid checksum line: %q", line)
+			}
+			sum, name = line[:i], strings.TrimPrefix(strings.TrimLeft(line[i:], " \t"), "*")
+		}
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != 2*newHash().Size() {
+			return nil, fmt.Errorf("invalid checksum: %q", sum)
+		}
+		// Names may use backslashes when the checksum file was created on Windows
+		name = filepath.FromSlash(strings.Replace(name, "\\", "/", -1))
+		if filepath.IsAbs(name) {
+			return nil, fmt.Errorf("invalid checksum path: %q", name)
+		}
+		sums = append(sums, checksum{path: filepath.Join(dir, name), sum: strings.ToLower(sum), hash: newHash})
+	}
+	return sums, scanner.Err()
+}
+
+func (c *checksum) verify() error {
+	f, err := os.Open(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("missing file: %q", c.path)
+		}
+		return err
+	}
+	defer f.Close()
+	h := c.hash()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != c.sum {
+		return fmt.Errorf("%w: %q: want %s, got %s", errChecksumMismatch, c.path, c.sum, sum)
+	}
+	return nil
+}
+
+// findChecksums returns the checksums listed in all checksum files below path. Checksum files are fetched from the
+// remote site, so files they list outside of path are rejected.
+func findChecksums(path string) ([]checksum, error) {
+	var sums []checksum
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if _, ok := checksumHashes[ext]; !ok || !fi.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		s, err := parseChecksums(f, filepath.Dir(p), ext)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		for _, sum := range s {
+			if !within(path, sum.path) {
+				return fmt.Errorf("%s: invalid checksum path: %q", p, sum.path)
+			}
+		}
+		sums = append(sums, s...)
+		return nil
+	})
+	return sums, err
+}
+
+// verify verifies the local files of this item against any checksum files it contains. Items without checksum files
+// are left unverified. Files with a checksum mismatch are recorded, so that they can be removed before transferring
+// again.
+func (i *Item) verify() {
+	i.Verified = false
+	i.VerifyError = ""
+	i.corrupt = nil
+	sums, err := findChecksums(i.LocalPath)
+	if err != nil {
+		i.VerifyError = err.Error()
+		return
+	}
+	if len(sums) == 0 {
+		return
+	}
+	for _, sum := range sums {
+		err := sum.verify()
+		if err == nil {
+			continue
+		}
+		if i.VerifyError == "" {
+			i.VerifyError = err.Error()
+		}
+		if !errors.Is(err, errChecksumMismatch) {
+			return
+		}
+		i.corrupt = append(i.corrupt, sum.path)
+	}
+	i.Verified = i.VerifyError == ""
+}
+
+// Verify verifies checksums of the transferable items in this queue, if VerifyChecksums is set. When RequeueFailed is
+// set, files with a checksum mismatch are removed and items that fail verification are transferred once more using
+// consumer and verified again.
+func (q *Queue) Verify(consumer Consumer) error {
+	if !q.VerifyChecksums {
+		return nil
+	}
+	var failed []*Item
+	for _, item := range q.Transferable() {
+		if item.verify(); item.VerifyError != "" {
+			failed = append(failed, item)
+		}
+	}
+	if len(failed) == 0 || !q.RequeueFailed {
+		return nil
+	}
+	retry := Queue{Site: q.Site, now: q.now}
+	for _, item := range failed {
+		// A corrupt file may have the same size as the remote one, in which case lftp would skip it
+		for _, path := range item.corrupt {
+			if !within(item.LocalPath, path) {
+				continue
+			}
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		retry.Items = append(retry.Items, *item)
+	}
+	if err := retry.Transfer(consumer); err != nil {
+		return err
+	}
+	for _, item := range failed {
+		item.verify()
+	}
+	return nil
+}
+
+// Unverified returns the items that failed verification.
+func (q *Queue) Unverified() []*Item {
+	var items []*Item
+	for _, item := range q.Transferable() {
+		if item.VerifyError != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
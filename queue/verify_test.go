@@ -0,0 +1,175 @@
+package queue
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type consumerFunc func(path string) error
+
+func (f consumerFunc) Consume(path string) error { return f(path) }
+
+func TestParseChecksums(t *testing.T) {
+	var tests = []struct {
+		in   string
+		ext  string
+		path string
+		sum  string
+		err  bool
+	}{
+		{"; comment\nfoo.r00 8C736521\n", ".sfv", "/d/foo.r00", "8c736521", false},
+		{"foo bar.rar\t8c736521", ".sfv", "/d/foo bar.rar", "8c736521", false},
+		{"Sample\\foo.mkv 8c736521", ".sfv", "/d/Sample/foo.mkv", "8c736521", false},
+		{"37b51d194a7513e45b56f6524f2d51f2  foo.mkv", ".md5", "/d/foo.mkv", "37b51d194a7513e45b56f6524f2d51f2", false},
+		{"37b51d194a7513e45b56f6524f2d51f2 *foo.mkv", ".md5", "/d/foo.mkv", "37b51d194a7513e45b56f6524f2d51f2", false},
+		{"/etc/passwd 8c736521", ".sfv", "", "", true},
+		{"37b51d194a7513e45b56f6524f2d51f2  /etc/passwd", ".md5", "", "", true},
+		{"foo.r00", ".sfv", "", "", true},
+		{"foo.r00 8c73652", ".sfv", "", "", true},
+		{"8c736521  foo.mkv", ".sha1", "", "", true},
+		{"8c736521  foo.mkv", ".txt", "", "", true},
+	}
+	for i, tt := range tests {
+		sums, err := parseChecksums(strings.NewReader(tt.in), "/d", tt.ext)
+		if (err != nil) != tt.err {
+			t.Errorf("#%d: want error %t, got %v", i, tt.err, err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		if len(sums) != 1 {
+			t.Errorf("#%d: want 1 checksum, got %d", i, len(sums))
+			continue
+		}
+		if got := sums[0]; got.path != tt.path || got.sum != tt.sum {
+			t.Errorf("#%d: want %s %s, got %s %s", i, tt.path, tt.sum, got.path, got.sum)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lftpq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, data string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("ok/foo.r00", "foo")
+	write("ok/foo.sfv", "foo.r00 8c736521\n")
+	write("bad/foo.r00", "bar")
+	write("bad/foo.sfv", "foo.r00 8c736521\n")
+	write("missing/foo.sfv", "foo.r00 8c736521\n")
+	write("none/foo.mkv", "foo")
+
+	s := newTestSite()
+	s.VerifyChecksums = true
+	q := Queue{Site: s}
+	for _, name := range []string{"ok", "bad", "missing", "none"} {
+		q.Items = append(q.Items, Item{RemotePath: "/remote/" + name, LocalPath: filepath.Join(dir, name), Transfer: true})
+	}
+	consumed := 0
+	if err := q.Verify(consumerFunc(func(path string) error { consumed++; return nil })); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		verified bool
+		err      string
+	}{
+		{true, ""},
+		{false, "checksum mismatch: \"" + filepath.Join(dir, "bad/foo.r00") + "\": want 8c736521, got 76ff8caa"},
+		{false, "missing file: \"" + filepath.Join(dir, "missing/foo.r00") + "\""},
+		{false, ""},
+	}
+	for i, tt := range tests {
+		item := q.Items[i]
+		if item.Verified != tt.verified || item.VerifyError != tt.err {
+			t.Errorf("#%d: want (%t, %q), got (%t, %q)", i, tt.verified, tt.err, item.Verified, item.VerifyError)
+		}
+	}
+	if consumed != 0 {
+		t.Errorf("want no retries, got %d", consumed)
+	}
+	if got := len(q.Unverified()); got != 2 {
+		t.Errorf("want 2 unverified items, got %d", got)
+	}
+
+	// Failed items are transferred again and verified
+	q.RequeueFailed = true
+	var script []byte
+	retry := func(path string) error {
+		consumed++
+		// The corrupt file is removed so that it is fetched again
+		if _, err := os.Stat(filepath.Join(dir, "bad/foo.r00")); !os.IsNotExist(err) {
+			t.Errorf("want corrupt file to be removed before retry, got %v", err)
+		}
+		script, err = ioutil.ReadFile(path)
+		write("bad/foo.r00", "foo")
+		return err
+	}
+	if err := q.Verify(consumerFunc(retry)); err != nil {
+		t.Fatal(err)
+	}
+	if consumed != 1 {
+		t.Errorf("want 1 retry, got %d", consumed)
+	}
+	want := "open test\n" +
+		"queue mirror '/remote/bad' '" + filepath.Join(dir, "bad") + "'\n" +
+		"queue mirror '/remote/missing' '" + filepath.Join(dir, "missing") + "'\n" +
+		"queue start\nwait\n"
+	if string(script) != want {
+		t.Errorf("want %q, got %q", want, script)
+	}
+	if !q.Items[1].Verified {
+		t.Errorf("want %s to be verified after retry, got %q", q.Items[1].RemotePath, q.Items[1].VerifyError)
+	}
+	if got := len(q.Unverified()); got != 1 {
+		t.Errorf("want 1 unverified item, got %d", got)
+	}
+}
+
+func TestVerifyEscapingChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lftpq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	victim := filepath.Join(dir, "victim.txt")
+	if err := ioutil.WriteFile(victim, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	release := filepath.Join(dir, "dl", "Release")
+	if err := os.MkdirAll(release, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(release, "foo.sfv"), []byte("../../victim.txt 00000000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestSite()
+	s.VerifyChecksums = true
+	s.RequeueFailed = true
+	q := Queue{Site: s}
+	q.Items = append(q.Items, Item{RemotePath: "/remote/Release", LocalPath: release, Transfer: true})
+	if err := q.Verify(consumerFunc(func(path string) error { return nil })); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Errorf("want file outside of item to be kept, got %v", err)
+	}
+	item := q.Items[0]
+	if want := filepath.Join(release, "foo.sfv") + ": invalid checksum path: \"" + victim + "\""; item.Verified || item.VerifyError != want {
+		t.Errorf("want (false, %q), got (%t, %q)", want, item.Verified, item.VerifyError)
+	}
+}
@@ -0,0 +1,162 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+type TransferWindow struct {
+	Days      []string
+	days      map[time.Weekday]bool
+	Hours     string
+	start     int
+	end       int
+	RateLimit string
+	rateLimit int64
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	if len(s) < 3 {
+		return 0, fmt.Errorf("invalid day: %q", s)
+	}
+	d, ok := weekdays[strings.ToLower(s[:3])]
+	if !ok {
+		return 0, fmt.Errorf("invalid day: %q", s)
+	}
+	return d, nil
+}
+
+func parseDays(days []string) (map[time.Weekday]bool, error) {
+	if len(days) == 0 {
+		return nil, nil
+	}
+	res := make(map[time.Weekday]bool)
+	for _, d := range days {
+		parts := strings.SplitN(d, "-", 2)
+		from, err := parseWeekday(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if len(parts) == 2 {
+			if to, err = parseWeekday(parts[1]); err != nil {
+				return nil, err
+			}
+		}
+		// Ranges can wrap around, e.g. Sat-Mon
+		for day := from; ; day = (day + 1) % 7 {
+			res[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// parseClock parses a time of day on the form HH or HH:MM, and returns the number of minutes since midnight
+func parseClock(s string) (int, error) {
+	parts := strings.SplitN(s, ":", 2)
+	h, err := strconv.Atoi(parts[0])
+	if err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("invalid hour: %q", s)
+	}
+	m := 0
+	if len(parts) == 2 {
+		if m, err = strconv.Atoi(parts[1]); err != nil || m < 0 || m > 59 || h == 24 && m > 0 {
+			return 0, fmt.Errorf("invalid minute: %q", s)
+		}
+	}
+	return h*60 + m, nil
+}
+
+func parseHours(hours string) (int, int, error) {
+	if hours == "" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(hours, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid hours: %q", hours)
+	}
+	start, err := parseClock(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+func compileWindows(windows []TransferWindow) ([]TransferWindow, error) {
+	res := make([]TransferWindow, 0, len(windows))
+	for _, w := range windows {
+		days, err := parseDays(w.Days)
+		if err != nil {
+			return nil, err
+		}
+		w.days = days
+		if w.start, w.end, err = parseHours(w.Hours); err != nil {
+			return nil, err
+		}
+		if w.RateLimit != "" {
+			if w.rateLimit, err = parseSize(w.RateLimit); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, w)
+	}
+	return res, nil
+}
+
+func (w *TransferWindow) onDay(d time.Weekday) bool {
+	return w.days == nil || w.days[d]
+}
+
+func (w *TransferWindow) contains(t time.Time) bool {
+	if w.start == w.end {
+		return w.onDay(t.Weekday())
+	}
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.onDay(t.Weekday()) && m >= w.start && m < w.end
+	}
+	// Window wraps around midnight, e.g. 22-06. The part after midnight belongs to the window starting the day before
+	if m >= w.start {
+		return w.onDay(t.Weekday())
+	}
+	return m < w.end && w.onDay((t.Weekday()+6)%7)
+}
+
+func (q *Queue) transferWindow() (*TransferWindow, bool) {
+	if len(q.TransferWindows) == 0 {
+		return nil, true
+	}
+	for i := range q.TransferWindows {
+		if w := &q.TransferWindows[i]; w.contains(q.now) {
+			return w, true
+		}
+	}
+	return nil, false
+}
+
+// InTransferWindow returns whether the queue can be transferred at the time it was created
+func (q *Queue) InTransferWindow() bool {
+	_, ok := q.transferWindow()
+	return ok
+}
+
+func (q *Queue) rateLimit() int64 {
+	if w, ok := q.transferWindow(); ok && w != nil && w.rateLimit > 0 {
+		return w.rateLimit
+	}
+	return q.Site.rateLimit
+}
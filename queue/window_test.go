@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileWindows(t *testing.T) {
+	var tests = []struct {
+		in    TransferWindow
+		valid bool
+	}{
+		{TransferWindow{}, true},
+		{TransferWindow{Days: []string{"Mon-Fri", "sunday"}, Hours: "08:30-17", RateLimit: "1MB"}, true},
+		{TransferWindow{Days: []string{"Foo"}}, false},
+		{TransferWindow{Days: []string{"Mon-X"}}, false},
+		{TransferWindow{Hours: "8"}, false},
+		{TransferWindow{Hours: "25-3"}, false},
+		{TransferWindow{Hours: "8:60-9"}, false},
+		{TransferWindow{RateLimit: "fast"}, false},
+	}
+	for _, tt := range tests {
+		if _, err := compileWindows([]TransferWindow{tt.in}); (err == nil) != tt.valid {
+			t.Errorf("compileWindows(%+v) = %v, want valid=%t", tt.in, err, tt.valid)
+		}
+	}
+}
+
+func TestTransferWindow(t *testing.T) {
+	windows, err := compileWindows([]TransferWindow{
+		{Days: []string{"Mon-Fri"}, Hours: "18-08", RateLimit: "2MiB"},
+		{Days: []string{"Sat-Sun"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestSite()
+	s.TransferWindows = windows
+	s.RateLimit, s.rateLimit = "1MiB", 1<<20
+	var tests = []struct {
+		now       time.Time
+		ok        bool
+		rateLimit int64
+	}{
+		{time.Date(2019, 3, 11, 12, 0, 0, 0, time.UTC), false, 1 << 20}, // Monday, office hours
+		{time.Date(2019, 3, 11, 7, 59, 0, 0, time.UTC), false, 1 << 20}, // Sunday night
+		{time.Date(2019, 3, 12, 7, 59, 0, 0, time.UTC), true, 2 << 20},  // Monday night
+		{time.Date(2019, 3, 16, 7, 59, 0, 0, time.UTC), true, 2 << 20},  // Friday night
+		{time.Date(2019, 3, 11, 8, 0, 0, 0, time.UTC), false, 1 << 20},
+		{time.Date(2019, 3, 11, 22, 0, 0, 0, time.UTC), true, 2 << 20},
+		{time.Date(2019, 3, 10, 12, 0, 0, 0, time.UTC), true, 1 << 20}, // Sunday
+	}
+	for _, tt := range tests {
+		q := Queue{Site: s, now: tt.now}
+		if got := q.InTransferWindow(); got != tt.ok {
+			t.Errorf("InTransferWindow() at %s = %t, want %t", tt.now, got, tt.ok)
+		}
+		if got := q.rateLimit(); got != tt.rateLimit {
+			t.Errorf("rateLimit() at %s = %d, want %d", tt.now, got, tt.rateLimit)
+		}
+	}
+}
+
+func TestMarshalTextRateLimit(t *testing.T) {
+	s := newTestSite()
+	s.rateLimit = 1 << 20
+	q := Queue{Site: s, now: time.Now()}
+	out, err := q.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "set net:limit-total-rate 1048576\nopen test\n"; !strings.HasPrefix(string(out), want) {
+		t.Errorf("want prefix %q, got %q", want, out)
+	}
+}